@@ -0,0 +1,302 @@
+package pgcache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// the state to maintain aggregates of a Data incrementally.
+type aggregateData struct {
+	kind    string
+	isFloat bool
+	// comparable type of an array of all layers' map keys.
+	groupKeyType reflect.Type
+	// comparable type of an array of unique key fields.
+	uniqueKeyType reflect.Type
+	groups        map[interface{}]*aggregateGroup
+}
+
+// the rows under the same map keys.
+type aggregateGroup struct {
+	keys []reflect.Value
+	// value of each row by unique key.
+	members map[interface{}]aggregateValue
+	sum     aggregateValue
+	// the compensation of the lost low-order bits of sum.f, by Kahan-Babuska summation.
+	compensation float64
+	// sorted values of members, only for min and max.
+	sorted []aggregateValue
+}
+
+type aggregateValue struct {
+	i int64
+	f float64
+}
+
+func (d *Data) checkAggregate(rowStruct reflect.Type) error {
+	switch d.Aggregate {
+	case "count", "sum", "min", "max":
+	default:
+		return fmt.Errorf(
+			`Data.Aggregate: %s, should be one of "count", "sum", "min", "max".`, d.Aggregate,
+		)
+	}
+	if d.dataV.Kind() != reflect.Map {
+		return errors.New("Data.DataPtr should be a map for Data.Aggregate.")
+	}
+	innerType, err := d.checkMapKeys(rowStruct)
+	if err != nil {
+		return err
+	}
+	if d.fanOut != nil {
+		return errors.New("Data.Aggregate: slice field in Data.MapKeys is not supported.")
+	}
+	if !isNumberKind(innerType.Kind()) {
+		return fmt.Errorf("Data.Aggregate: map value type %v is not a number type.", innerType)
+	}
+	a := &aggregateData{
+		kind:    d.Aggregate,
+		isFloat: innerType.Kind() == reflect.Float32 || innerType.Kind() == reflect.Float64,
+		groups:  make(map[interface{}]*aggregateGroup),
+	}
+
+	if d.ValueFunc != nil {
+		return errors.New("Data.ValueFunc is not supported for Data.Aggregate.")
+	}
+	if d.Aggregate == "count" {
+		if d.Value != "" {
+			return errors.New(`Data.Value should be empty for "count" Data.Aggregate.`)
+		}
+	} else if field, ok := rowStruct.FieldByName(d.Value); !ok {
+		return fmt.Errorf("Data.Value: %s, no such field in row struct.", d.Value)
+	} else if !isNumberKind(field.Type.Kind()) {
+		return fmt.Errorf("Data.Value: %s, type %v is not a number type.", d.Value, field.Type)
+	} else if !aggregatable(field.Type.Kind(), innerType.Kind()) {
+		return fmt.Errorf(
+			"Data.Value: %s, type %v can't be aggregated into map value type %v.",
+			d.Value, field.Type, innerType,
+		)
+	}
+
+	if len(d.AggregateUniqueKey) == 0 {
+		if _, ok := rowStruct.FieldByName("Id"); ok {
+			d.AggregateUniqueKey = []string{"Id"}
+		} else {
+			return errors.New("Data.AggregateUniqueKey is required.")
+		}
+	}
+	for i, name := range d.AggregateUniqueKey {
+		if field, ok := rowStruct.FieldByName(name); !ok {
+			return fmt.Errorf("Data.AggregateUniqueKey[%d]: %s, no such field in row struct.", i, name)
+		} else if !field.Type.Comparable() {
+			return fmt.Errorf("Data.AggregateUniqueKey[%d]: %s, is not comparable.", i, name)
+		}
+	}
+	a.groupKeyType = reflect.ArrayOf(len(d.MapKeys), interfaceType)
+	a.uniqueKeyType = reflect.ArrayOf(len(d.AggregateUniqueKey), interfaceType)
+	d.aggregate = a
+	return nil
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// aggregatable reports if a value of the kind can be aggregated into a map value of the mapKind
+// without loss: any number into a float, a signed integer into a signed integer, and an unsigned
+// integer into an unsigned integer.
+func aggregatable(kind, mapKind reflect.Kind) bool {
+	switch mapKind {
+	case reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return kind >= reflect.Int && kind <= reflect.Int64
+	default:
+		return kind >= reflect.Uint && kind <= reflect.Uint64
+	}
+}
+
+// saveAggregate should be called with the lock held.
+func (d *Data) saveAggregate(row reflect.Value) {
+	a := d.aggregate
+	group := a.group(d, row, true)
+	if group == nil {
+		return
+	}
+	value := a.value(row, d.Value)
+	uniqueKey := a.uniqueKey(row, d.AggregateUniqueKey)
+	if old, ok := group.members[uniqueKey]; ok {
+		if old == value {
+			return
+		}
+		a.removeValue(group, old)
+	}
+	group.members[uniqueKey] = value
+	a.addValue(group, value)
+	d.setAggregate(group)
+}
+
+// removeAggregate should be called with the lock held.
+func (d *Data) removeAggregate(row reflect.Value) {
+	a := d.aggregate
+	group := a.group(d, row, false)
+	if group == nil {
+		return
+	}
+	uniqueKey := a.uniqueKey(row, d.AggregateUniqueKey)
+	old, ok := group.members[uniqueKey]
+	if !ok {
+		return
+	}
+	delete(group.members, uniqueKey)
+	a.removeValue(group, old)
+	d.setAggregate(group)
+}
+
+// setAggregate sets the aggregate of the group to the map, or deletes it if the group is empty.
+func (d *Data) setAggregate(group *aggregateGroup) {
+	a := d.aggregate
+	if len(group.members) == 0 {
+		d.removeKey(group.keys)
+		return
+	}
+
+	var result aggregateValue
+	switch a.kind {
+	case "count":
+		result = aggregateValue{i: int64(len(group.members)), f: float64(len(group.members))}
+	case "sum":
+		result = aggregateValue{i: group.sum.i, f: group.sum.f + group.compensation}
+	case "min":
+		result = group.sorted[0]
+	case "max":
+		result = group.sorted[len(group.sorted)-1]
+	}
+
+	mapV := d.dataV
+	if mapV.IsNil() {
+		mapV.Set(reflect.MakeMap(mapV.Type()))
+	}
+	for i := 0; i < len(group.keys)-1; i++ {
+		value := mapV.MapIndex(group.keys[i])
+		if !value.IsValid() || value.IsNil() {
+			value = reflect.MakeMap(mapV.Type().Elem())
+			mapV.SetMapIndex(group.keys[i], value)
+		}
+		mapV = value
+	}
+	resultV := reflect.New(mapV.Type().Elem()).Elem()
+	switch resultV.Kind() {
+	case reflect.Float32, reflect.Float64:
+		resultV.SetFloat(result.f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		resultV.SetInt(result.i)
+	default:
+		resultV.SetUint(uint64(result.i))
+	}
+	mapV.SetMapIndex(group.keys[len(group.keys)-1], resultV)
+}
+
+func (a *aggregateData) group(d *Data, row reflect.Value, create bool) *aggregateGroup {
+	rowKeys := d.mapKeys(row)
+	if len(rowKeys) == 0 {
+		// a NULL key.
+		return nil
+	}
+	array := reflect.New(a.groupKeyType).Elem()
+	typ := d.dataV.Type()
+	var keys = make([]reflect.Value, len(d.MapKeys))
+	for i := range keys {
+		keys[i] = rowKeys[0][i].Convert(typ.Key())
+		array.Index(i).Set(keys[i])
+		typ = typ.Elem()
+	}
+	key := array.Interface()
+	group := a.groups[key]
+	if group == nil && create {
+		group = &aggregateGroup{keys: keys, members: make(map[interface{}]aggregateValue)}
+		a.groups[key] = group
+	}
+	return group
+}
+
+func (a *aggregateData) uniqueKey(row reflect.Value, fields []string) interface{} {
+	array := reflect.New(a.uniqueKeyType).Elem()
+	for i, name := range fields {
+		array.Index(i).Set(row.FieldByName(name))
+	}
+	return array.Interface()
+}
+
+func (a *aggregateData) value(row reflect.Value, field string) aggregateValue {
+	if a.kind == "count" {
+		return aggregateValue{}
+	}
+	v := row.FieldByName(field)
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return aggregateValue{i: int64(v.Float()), f: v.Float()}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return aggregateValue{i: v.Int(), f: float64(v.Int())}
+	default:
+		return aggregateValue{i: int64(v.Uint()), f: float64(v.Uint())}
+	}
+}
+
+func (a *aggregateData) addValue(group *aggregateGroup, value aggregateValue) {
+	switch a.kind {
+	case "sum":
+		group.sum.i += value.i
+		group.addFloat(value.f)
+	case "min", "max":
+		i := sort.Search(len(group.sorted), func(i int) bool {
+			return !a.less(group.sorted[i], value)
+		})
+		group.sorted = append(group.sorted, aggregateValue{})
+		copy(group.sorted[i+1:], group.sorted[i:])
+		group.sorted[i] = value
+	}
+}
+
+func (a *aggregateData) removeValue(group *aggregateGroup, value aggregateValue) {
+	switch a.kind {
+	case "sum":
+		group.sum.i -= value.i
+		group.addFloat(-value.f)
+	case "min", "max":
+		i := sort.Search(len(group.sorted), func(i int) bool {
+			return !a.less(group.sorted[i], value)
+		})
+		if i < len(group.sorted) && group.sorted[i] == value {
+			group.sorted = append(group.sorted[:i], group.sorted[i+1:]...)
+		}
+	}
+}
+
+// addFloat adds f to the float sum, and keeps the lost low-order bits in the compensation, so the
+// sum doesn't drift after many additions and subtractions.
+func (g *aggregateGroup) addFloat(f float64) {
+	sum := g.sum.f + f
+	if math.Abs(g.sum.f) >= math.Abs(f) {
+		g.compensation += (g.sum.f - sum) + f
+	} else {
+		g.compensation += (f - sum) + g.sum.f
+	}
+	g.sum.f = sum
+}
+
+func (a *aggregateData) less(x, y aggregateValue) bool {
+	if a.isFloat {
+		return x.f < y.f
+	}
+	return x.i < y.i
+}
@@ -0,0 +1,115 @@
+package pgcache
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+func ExampleData_aggregate() {
+	var counts map[int]int64
+	var sums map[int]int
+	var mins map[string]float64
+	var maxes map[string]map[int]int64
+	var mutex sync.RWMutex
+	unique := []string{"StudentId", "Subject"}
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &counts, MapKeys: []string{"StudentId"},
+				Aggregate: "count", AggregateUniqueKey: unique},
+			{RWMutex: &mutex, DataPtr: &sums, MapKeys: []string{"StudentId"},
+				Aggregate: "sum", Value: "Score", AggregateUniqueKey: unique},
+			{RWMutex: &mutex, DataPtr: &mins, MapKeys: []string{"Subject"},
+				Aggregate: "min", Value: "Score", AggregateUniqueKey: unique},
+			{RWMutex: &mutex, DataPtr: &maxes, MapKeys: []string{"Subject", "StudentId"},
+				Aggregate: "max", Value: "Score", AggregateUniqueKey: unique},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+	fmt.Println(counts, sums, mins, maxes)
+
+	t.Create("", []byte(`{"StudentId": 1000, "Subject": "数学", "Score": 95}`))
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 80}`))
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 80}`)) // duplicated
+	fmt.Println(counts, sums, mins, maxes)
+
+	t.Update("",
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 80}`),
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 99}`),
+	)
+	fmt.Println(counts, sums, mins, maxes)
+
+	t.Delete("", []byte(`{"StudentId": 1000, "Subject": "语文", "Score": 90}`))
+	fmt.Println(counts, sums, mins, maxes)
+
+	t.Reload(false)
+	fmt.Println(counts, sums, mins, maxes)
+	fmt.Println(t.Datas[1].Key())
+
+	// Output:
+	// <nil>
+	// map[1000:1] map[1000:90] map[语文:90] map[语文:map[1000:90]]
+	// map[1000:2 1001:1] map[1000:185 1001:80] map[数学:95 语文:80] map[数学:map[1000:95] 语文:map[1000:90 1001:80]]
+	// map[1000:2 1001:1] map[1000:185 1001:99] map[数学:95 语文:90] map[数学:map[1000:95] 语文:map[1000:90 1001:99]]
+	// map[1000:1 1001:1] map[1000:95 1001:99] map[数学:95 语文:99] map[数学:map[1000:95] 语文:map[1001:99]]
+	// map[1000:1] map[1000:90] map[语文:90] map[语文:map[1000:90]]
+	// map[StudentId:int]sum(Score):int
+}
+
+func ExampleData_init_invalidAggregate() {
+	var mutex sync.RWMutex
+	for _, d := range []Data{
+		{RWMutex: &mutex, DataPtr: &map[int]int{}, MapKeys: []string{"StudentId"}, Aggregate: "avg"},
+		{RWMutex: &mutex, DataPtr: &[]int{}, Aggregate: "count"},
+		{RWMutex: &mutex, DataPtr: &map[int]string{}, MapKeys: []string{"StudentId"},
+			Aggregate: "count"},
+		{RWMutex: &mutex, DataPtr: &map[int]int{}, MapKeys: []string{"StudentId"},
+			Aggregate: "sum", Value: "Subject"},
+		{RWMutex: &mutex, DataPtr: &map[int]int{}, MapKeys: []string{"StudentId"},
+			Aggregate: "count"},
+		{RWMutex: &mutex, DataPtr: &map[int]uint{}, MapKeys: []string{"StudentId"},
+			Aggregate: "sum", Value: "Score"},
+		{RWMutex: &mutex, DataPtr: &map[int]int{}, MapKeys: []string{"StudentId"},
+			Aggregate: "sum", Value: "Price"},
+	} {
+		fmt.Println(d.init(reflect.TypeOf(struct {
+			StudentId int
+			Subject   string
+			Score     int
+			Price     float64
+		}{})))
+	}
+	// Output:
+	// Data.Aggregate: avg, should be one of "count", "sum", "min", "max".
+	// Data.DataPtr should be a map for Data.Aggregate.
+	// Data.Aggregate: map value type string is not a number type.
+	// Data.Value: Subject, type string is not a number type.
+	// Data.AggregateUniqueKey is required.
+	// Data.Value: Score, type int can't be aggregated into map value type uint.
+	// Data.Value: Price, type float64 can't be aggregated into map value type int.
+}
+
+func ExampleData_aggregate_floatSum() {
+	type Order struct {
+		Id     int
+		UserId int
+		Price  float64
+	}
+	var sums map[int]float64
+	var mutex sync.RWMutex
+	d := &Data{
+		RWMutex: &mutex, DataPtr: &sums, MapKeys: []string{"UserId"}, Aggregate: "sum", Value: "Price",
+	}
+	fmt.Println(d.init(reflect.TypeOf(Order{})))
+	d.save(reflect.ValueOf(Order{Id: 1, UserId: 1, Price: 0.1}))
+	for i := 0; i < 1000; i++ {
+		d.save(reflect.ValueOf(Order{Id: 2, UserId: 1, Price: 1e8 + float64(i)/10}))
+		d.remove(reflect.ValueOf(Order{Id: 2, UserId: 1}))
+	}
+	fmt.Println(sums[1] == 0.1)
+	// Output:
+	// <nil>
+	// true
+}
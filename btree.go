@@ -0,0 +1,290 @@
+package pgcache
+
+import "sort"
+
+// btree is an in-memory B-tree of index items, which are unique by the less function.
+type btree struct {
+	degree int
+	length int
+	root   *btreeNode
+	less   func(a, b *indexItem) bool
+}
+
+type btreeNode struct {
+	items []*indexItem
+	// children is empty for a leaf node, otherwise it has len(items)+1 nodes.
+	children []*btreeNode
+}
+
+const btreeDegree = 32
+
+func newBtree(less func(a, b *indexItem) bool) *btree {
+	return &btree{degree: btreeDegree, less: less}
+}
+
+func (t *btree) maxItems() int {
+	return t.degree*2 - 1
+}
+
+func (t *btree) minItems() int {
+	return t.degree - 1
+}
+
+// replaceOrInsert inserts the item, and returns the item replaced if any.
+func (t *btree) replaceOrInsert(item *indexItem) *indexItem {
+	if t.root == nil {
+		t.root = &btreeNode{items: []*indexItem{item}}
+		t.length++
+		return nil
+	}
+	if len(t.root.items) >= t.maxItems() {
+		middle, second := t.root.split(t.maxItems() / 2)
+		t.root = &btreeNode{
+			items:    []*indexItem{middle},
+			children: []*btreeNode{t.root, second},
+		}
+	}
+	out := t.root.insert(item, t.maxItems(), t.less)
+	if out == nil {
+		t.length++
+	}
+	return out
+}
+
+// delete removes the item, and returns the item removed if any.
+func (t *btree) delete(item *indexItem) *indexItem {
+	if t.root == nil || len(t.root.items) == 0 {
+		return nil
+	}
+	out := t.root.remove(item, t.minItems(), t.less)
+	if len(t.root.items) == 0 && len(t.root.children) > 0 {
+		t.root = t.root.children[0]
+	}
+	if out != nil {
+		t.length--
+	}
+	return out
+}
+
+// ascend calls fn for the items in ascending order, starting from the first item which "from"
+// returns true for, until fn returns false. If "from" is nil, it starts from the first item.
+// "from" should be monotonic: false for some leading items, and true for all the rest.
+func (t *btree) ascend(from func(*indexItem) bool, fn func(*indexItem) bool) {
+	if t.root != nil {
+		t.root.ascend(from, fn)
+	}
+}
+
+// descend calls fn for the items in descending order, starting from the last item which "to"
+// returns true for, until fn returns false. If "to" is nil, it starts from the last item.
+// "to" should be monotonic: true for some leading items, and false for all the rest.
+func (t *btree) descend(to func(*indexItem) bool, fn func(*indexItem) bool) {
+	if t.root != nil {
+		t.root.descend(to, fn)
+	}
+}
+
+// find returns the index where the item is found or should be inserted.
+func (n *btreeNode) find(item *indexItem, less func(a, b *indexItem) bool) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool {
+		return less(item, n.items[i])
+	})
+	if i > 0 && !less(n.items[i-1], item) {
+		return i - 1, true
+	}
+	return i, false
+}
+
+// split splits the node at index i, it returns the item at i and a new node of the rest.
+func (n *btreeNode) split(i int) (*indexItem, *btreeNode) {
+	item := n.items[i]
+	next := &btreeNode{items: append([]*indexItem(nil), n.items[i+1:]...)}
+	for j := i; j < len(n.items); j++ {
+		n.items[j] = nil
+	}
+	n.items = n.items[:i]
+	if len(n.children) > 0 {
+		next.children = append([]*btreeNode(nil), n.children[i+1:]...)
+		for j := i + 1; j < len(n.children); j++ {
+			n.children[j] = nil
+		}
+		n.children = n.children[:i+1]
+	}
+	return item, next
+}
+
+// maybeSplitChild splits the i-th child if it's full, and returns whether a split occurred.
+func (n *btreeNode) maybeSplitChild(i, maxItems int) bool {
+	if len(n.children[i].items) < maxItems {
+		return false
+	}
+	item, second := n.children[i].split(maxItems / 2)
+	n.items = insertItemAt(n.items, i, item)
+	n.children = insertNodeAt(n.children, i+1, second)
+	return true
+}
+
+func (n *btreeNode) insert(item *indexItem, maxItems int, less func(a, b *indexItem) bool) *indexItem {
+	i, found := n.find(item, less)
+	if found {
+		out := n.items[i]
+		n.items[i] = item
+		return out
+	}
+	if len(n.children) == 0 {
+		n.items = insertItemAt(n.items, i, item)
+		return nil
+	}
+	if n.maybeSplitChild(i, maxItems) {
+		switch middle := n.items[i]; {
+		case less(item, middle):
+		case less(middle, item):
+			i++
+		default:
+			n.items[i] = item
+			return middle
+		}
+	}
+	return n.children[i].insert(item, maxItems, less)
+}
+
+func (n *btreeNode) remove(item *indexItem, minItems int, less func(a, b *indexItem) bool) *indexItem {
+	i, found := n.find(item, less)
+	if len(n.children) == 0 {
+		if !found {
+			return nil
+		}
+		out := n.items[i]
+		n.items = removeItemAt(n.items, i)
+		return out
+	}
+	if len(n.children[i].items) <= minItems {
+		n.grow(i, minItems)
+		return n.remove(item, minItems, less)
+	}
+	if found {
+		out := n.items[i]
+		n.items[i] = n.children[i].removeMax(minItems)
+		return out
+	}
+	return n.children[i].remove(item, minItems, less)
+}
+
+func (n *btreeNode) removeMax(minItems int) *indexItem {
+	if len(n.children) == 0 {
+		out := n.items[len(n.items)-1]
+		n.items = removeItemAt(n.items, len(n.items)-1)
+		return out
+	}
+	i := len(n.items)
+	if len(n.children[i].items) <= minItems {
+		n.grow(i, minItems)
+		return n.removeMax(minItems)
+	}
+	return n.children[i].removeMax(minItems)
+}
+
+// grow makes the i-th child have more than minItems items, by stealing an item from a sibling,
+// or merging with a sibling.
+func (n *btreeNode) grow(i, minItems int) {
+	if i > 0 && len(n.children[i-1].items) > minItems {
+		child, left := n.children[i], n.children[i-1]
+		stolen := left.items[len(left.items)-1]
+		left.items = removeItemAt(left.items, len(left.items)-1)
+		child.items = insertItemAt(child.items, 0, n.items[i-1])
+		n.items[i-1] = stolen
+		if len(left.children) > 0 {
+			last := left.children[len(left.children)-1]
+			left.children = removeNodeAt(left.children, len(left.children)-1)
+			child.children = insertNodeAt(child.children, 0, last)
+		}
+		return
+	}
+	if i < len(n.items) && len(n.children[i+1].items) > minItems {
+		child, right := n.children[i], n.children[i+1]
+		stolen := right.items[0]
+		right.items = removeItemAt(right.items, 0)
+		child.items = append(child.items, n.items[i])
+		n.items[i] = stolen
+		if len(right.children) > 0 {
+			child.children = append(child.children, right.children[0])
+			right.children = removeNodeAt(right.children, 0)
+		}
+		return
+	}
+	if i >= len(n.items) {
+		i--
+	}
+	child, right := n.children[i], n.children[i+1]
+	child.items = append(child.items, n.items[i])
+	child.items = append(child.items, right.items...)
+	child.children = append(child.children, right.children...)
+	n.items = removeItemAt(n.items, i)
+	n.children = removeNodeAt(n.children, i+1)
+}
+
+func (n *btreeNode) ascend(from func(*indexItem) bool, fn func(*indexItem) bool) bool {
+	i := 0
+	if from != nil {
+		i = sort.Search(len(n.items), func(i int) bool { return from(n.items[i]) })
+	}
+	for ; i < len(n.items); i++ {
+		if len(n.children) > 0 && !n.children[i].ascend(from, fn) {
+			return false
+		}
+		// all the items after are not before the start.
+		from = nil
+		if !fn(n.items[i]) {
+			return false
+		}
+	}
+	if len(n.children) > 0 {
+		return n.children[len(n.children)-1].ascend(from, fn)
+	}
+	return true
+}
+
+func (n *btreeNode) descend(to func(*indexItem) bool, fn func(*indexItem) bool) bool {
+	i := len(n.items)
+	if to != nil {
+		i = sort.Search(len(n.items), func(i int) bool { return !to(n.items[i]) })
+	}
+	if len(n.children) > 0 && !n.children[i].descend(to, fn) {
+		return false
+	}
+	for i--; i >= 0; i-- {
+		if !fn(n.items[i]) {
+			return false
+		}
+		if len(n.children) > 0 && !n.children[i].descend(nil, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func insertItemAt(items []*indexItem, i int, item *indexItem) []*indexItem {
+	items = append(items, nil)
+	copy(items[i+1:], items[i:])
+	items[i] = item
+	return items
+}
+
+func removeItemAt(items []*indexItem, i int) []*indexItem {
+	copy(items[i:], items[i+1:])
+	items[len(items)-1] = nil
+	return items[:len(items)-1]
+}
+
+func insertNodeAt(nodes []*btreeNode, i int, node *btreeNode) []*btreeNode {
+	nodes = append(nodes, nil)
+	copy(nodes[i+1:], nodes[i:])
+	nodes[i] = node
+	return nodes
+}
+
+func removeNodeAt(nodes []*btreeNode, i int) []*btreeNode {
+	copy(nodes[i:], nodes[i+1:])
+	nodes[len(nodes)-1] = nil
+	return nodes[:len(nodes)-1]
+}
@@ -0,0 +1,125 @@
+package pgcache
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// initChangeFields finds the top level fields of row struct which the Data depends on, so an update
+// which doesn't change them is skipped, or saved in place without removing the old row.
+func (d *Data) initChangeFields(rowStruct reflect.Type) error {
+	for i, name := range d.PrecondFields {
+		if _, ok := rowStruct.FieldByName(name); !ok {
+			return fmt.Errorf("Data.PrecondFields[%d]: %s, no such field in row struct.", i, name)
+		}
+	}
+	d.keyFields, d.valueFields, d.alwaysUpdate = nil, nil, false
+	// the fields used by Preprocess or Precond are unknown.
+	if d.preprocessMethodIndex >= 0 || d.precondMethodIndex >= 0 && len(d.PrecondFields) == 0 {
+		d.alwaysUpdate = true
+		return nil
+	}
+
+	// the fields used by a computed key or value are unknown.
+	for _, g := range append(d.keyGetters[:len(d.keyGetters):len(d.keyGetters)], d.valueGetter) {
+		if g != nil && g.fields == nil {
+			d.alwaysUpdate = true
+			return nil
+		}
+	}
+
+	keys := [][]string{
+		d.AggregateUniqueKey, d.IndexKeys, d.IndexUniqueKey, d.SearchFields, d.PrecondFields,
+	}
+	for _, g := range d.keyGetters {
+		keys = append(keys, g.fields)
+	}
+	if d.valueGetter != nil && d.valueGetter.nullable {
+		// a NULL value is not saved, so it can't be saved in place.
+		keys = append(keys, d.valueGetter.fields)
+	}
+	if d.isSortedSets || d.dataV.Kind() == reflect.Slice {
+		// a sorted set is ordered by the value, or "SortBy" and "SortedSetUniqueKey" of the value.
+		if d.valueGetter != nil {
+			keys = append(keys, d.valueGetter.fields)
+		} else if d.SortLess != nil {
+			// the fields used by SortLess are unknown.
+			d.alwaysUpdate = true
+			return nil
+		} else {
+			keys = append(keys, d.SortedSetUniqueKey)
+			if d.sortOrder != nil {
+				keys = append(keys, d.sortOrder.names)
+			}
+		}
+	}
+	for _, names := range keys {
+		d.keyFields = append(d.keyFields, topFieldIndexes(rowStruct, names)...)
+	}
+	if d.valueGetter != nil {
+		d.valueFields = topFieldIndexes(rowStruct, d.valueGetter.fields)
+	}
+	return nil
+}
+
+// topFieldIndexes returns the indexes of the top level fields which has or embeds the fields.
+func topFieldIndexes(rowStruct reflect.Type, names []string) []int {
+	var result []int
+	for _, name := range names {
+		if field, ok := rowStruct.FieldByName(name); ok {
+			result = append(result, field.Index[0])
+		}
+	}
+	return result
+}
+
+// changedFields reports if each top level field is changed from the old row to the new row.
+// Unexported fields are not decoded, so they're taken as unchanged.
+func changedFields(oldRow, newRow reflect.Value) []bool {
+	changed := make([]bool, oldRow.NumField())
+	for i := range changed {
+		if oldField := oldRow.Field(i); oldField.CanInterface() {
+			changed[i] = !reflect.DeepEqual(oldField.Interface(), newRow.Field(i).Interface())
+		}
+	}
+	return changed
+}
+
+// changedNames returns the names of the changed top level fields.
+func changedNames(rowStruct reflect.Type, changed []bool) []string {
+	var names = []string{}
+	for i := range changed {
+		if changed[i] {
+			names = append(names, rowStruct.Field(i).Name)
+		}
+	}
+	return names
+}
+
+// affected reports if the keys or the value of the Data are affected by the changed fields.
+// If changed is nil, every field is taken as changed.
+func (d *Data) affected(changed []bool) (keys, value bool) {
+	if changed == nil || d.alwaysUpdate {
+		return true, true
+	}
+	for _, i := range d.keyFields {
+		if changed[i] {
+			return true, true
+		}
+	}
+	if d.valueFields == nil {
+		// the value is the whole row.
+		for i := range changed {
+			if changed[i] {
+				return false, true
+			}
+		}
+		return false, false
+	}
+	for _, i := range d.valueFields {
+		if changed[i] {
+			return false, true
+		}
+	}
+	return false, false
+}
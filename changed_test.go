@@ -0,0 +1,95 @@
+package pgcache
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+func Example_changedFields() {
+	changed := changedFields(
+		reflect.ValueOf(Score{StudentId: 1001, Subject: "语文", Score: 95}),
+		reflect.ValueOf(Score{StudentId: 1001, Subject: "数学", Score: 96}),
+	)
+	fmt.Println(changed, changedNames(reflect.TypeOf(Score{}), changed))
+	// Output: [false true true] [Subject Score]
+}
+
+func ExampleData_affected() {
+	var mutex sync.RWMutex
+	var m1 map[int]map[string]int
+	var m2 map[string][]Score
+	var m3 map[int]int
+	var s []int
+	datas := []*Data{
+		{RWMutex: &mutex, DataPtr: &m1, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		{RWMutex: &mutex, DataPtr: &m2, MapKeys: []string{"Subject"}, SortedSetUniqueKey: []string{"StudentId"}},
+		{RWMutex: &mutex, DataPtr: &m3, MapKeys: []string{"StudentId"}, Value: "Score",
+			Precond: "Valid", PrecondFields: []string{"Score"}},
+		{RWMutex: &mutex, DataPtr: &m3, MapKeys: []string{"StudentId"}, Value: "Score", Precond: "Valid"},
+		{RWMutex: &mutex, DataPtr: &s, Value: "Score"},
+	}
+	t := &Table{Name: "scores", RowStruct: Score{}, Datas: datas}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	for _, changed := range [][]bool{{false, false, false}, {false, false, true}, {false, true, false}} {
+		var results []bool
+		for _, d := range datas {
+			keys, value := d.affected(changed)
+			results = append(results, keys, value)
+		}
+		fmt.Println(results)
+	}
+	fmt.Println(t.AddData(&Data{
+		RWMutex: &mutex, DataPtr: &m3, MapKeys: []string{"StudentId"}, Value: "Score",
+		PrecondFields: []string{"Name"},
+	}))
+	// Output:
+	// <nil>
+	// [false false false false false false true true false false]
+	// [false true false true true true true true true true]
+	// [true true true true false false true true false false]
+	// Data.PrecondFields[0]: Name, no such field in row struct.
+}
+
+func ExampleTable_Update_fields() {
+	var mutex sync.RWMutex
+	var bySubject map[string][]Score
+	var byStudent map[int]map[string]*Score
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &bySubject, MapKeys: []string{"Subject"},
+				SortedSetUniqueKey: []string{"StudentId"}},
+			{RWMutex: &mutex, DataPtr: &byStudent, MapKeys: []string{"StudentId", "Subject"}},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+
+	var events = make(chan ChangeEvent, 10)
+	cancel := t.Subscribe(func(event ChangeEvent) { events <- event }, &SubscribeOptions{
+		Fields: []string{"Subject"},
+	})
+	defer cancel()
+
+	// saved in place.
+	t.Update("",
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`),
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 97}`),
+	)
+	fmt.Println(bySubject, *byStudent[1001]["语文"])
+	t.Update("",
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 97}`),
+		[]byte(`{"StudentId": 1001, "Subject": "数学", "Score": 97}`),
+	)
+	fmt.Println(bySubject, *byStudent[1001]["数学"])
+	event := <-events
+	fmt.Println(event.Type, event.Changed, len(events))
+
+	// Output:
+	// <nil>
+	// map[语文:[{1000 语文 90} {1001 语文 97}]] {1001 语文 97}
+	// map[数学:[{1001 数学 97}] 语文:[{1000 语文 90}]] {1001 数学 97}
+	// update [Subject] 0
+}
@@ -0,0 +1,231 @@
+package pgcache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/lovego/bsql/scan"
+	"github.com/lovego/struct_tag"
+	"github.com/lovego/structs"
+)
+
+// rowColumn is the column of a field of "RowStruct".
+type rowColumn struct {
+	field reflect.StructField
+	// the column name in the table.
+	column string
+	// the name of the column in "Columns", "LoadSql" and the notifications. It's the column name if
+	// "scan.Column2Field" maps it back to the field, otherwise it's an alias which does.
+	name string
+	// the options of the pgcache tag.
+	pk, big, index bool
+}
+
+// rowColumns returns the columns of the fields of the row struct. The column of a field is set by
+// the "column" option of the pgcache tag or by the db tag, such as `pgcache:"column=stu_name"` or
+// `db:"stu_name"`, otherwise it's converted from the field name by "Field2Column". A field is
+// ignored if its pgcache or db tag is "-", or it has neither of them and its json tag is "-".
+func rowColumns(rowStruct reflect.Type) ([]rowColumn, error) {
+	var result []rowColumn
+	var err error
+	structs.TraverseType(rowStruct, func(field reflect.StructField) {
+		if err != nil {
+			return
+		}
+		var c rowColumn
+		var ok bool
+		if c, ok, err = newRowColumn(field); ok {
+			result = append(result, c)
+		}
+	})
+	return result, err
+}
+
+func newRowColumn(field reflect.StructField) (rowColumn, bool, error) {
+	c := rowColumn{field: field}
+	tag, hasTag := struct_tag.Lookup(string(field.Tag), "pgcache")
+	if tag == "-" {
+		return c, false, nil
+	}
+	if hasTag {
+		for _, option := range strings.Split(tag, ",") {
+			switch option = strings.TrimSpace(option); {
+			case strings.HasPrefix(option, "column="):
+				c.column = strings.TrimSpace(strings.TrimPrefix(option, "column="))
+			case option == "pk":
+				c.pk = true
+			case option == "big":
+				c.big = true
+			case option == "index":
+				c.index = true
+			case option != "":
+				return c, false, fmt.Errorf(
+					`RowStruct.%s: unknown option "%s" in pgcache tag.`, field.Name, option,
+				)
+			}
+		}
+		if c.pk && c.big {
+			return c, false, fmt.Errorf("RowStruct.%s: a pk field should not be big.", field.Name)
+		}
+	}
+	if dbTag, ok := struct_tag.Lookup(string(field.Tag), "db"); ok {
+		dbTag = strings.TrimSpace(strings.Split(dbTag, ",")[0])
+		if dbTag == "-" {
+			return c, false, nil
+		}
+		if c.column == "" {
+			c.column = dbTag
+		}
+		hasTag = true
+	}
+	if !hasTag && struct_tag.Get(string(field.Tag), "json") == "-" {
+		return c, false, nil
+	}
+
+	if c.column == "" {
+		c.column = Field2Column(field.Name)
+	}
+	if c.name = c.column; scan.Column2Field(c.name) != field.Name {
+		if c.name = Field2Column(field.Name); scan.Column2Field(c.name) != field.Name {
+			c.name = field.Name
+		}
+	}
+	return c, true, nil
+}
+
+// selectItem returns the item of the column in a select list, such as `"stuName" AS name`.
+func (c rowColumn) selectItem() string {
+	if c.name == c.column {
+		return quoteColumn(c.column)
+	}
+	return quoteColumn(c.column) + " AS " + quoteColumn(c.name)
+}
+
+var plainColumnRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// quoteColumn quotes the column name, unless it's a plain lower case name.
+func quoteColumn(column string) string {
+	if plainColumnRegexp.MatchString(column) {
+		return column
+	}
+	return `"` + strings.Replace(column, `"`, `""`, -1) + `"`
+}
+
+// column returns the column of a field of the row struct.
+func (t *Table) column(fieldName string) rowColumn {
+	for _, c := range t.rowColumns {
+		if c.field.Name == fieldName {
+			return c
+		}
+	}
+	column := Field2Column(fieldName)
+	return rowColumn{column: column, name: column}
+}
+
+// fieldsByColumn maps the column names and their names in "Columns" to the row struct fields.
+func (t *Table) fieldsByColumn() map[string]reflect.StructField {
+	var result = make(map[string]reflect.StructField)
+	for _, c := range t.rowColumns {
+		result[c.column] = c.field
+		result[c.name] = c.field
+	}
+	return result
+}
+
+func columnsFromRowStruct(columns []rowColumn, exclude string) string {
+	var excluding []string
+	if exclude != "" {
+		excluding = strings.Split(exclude, ",")
+		for i := range excluding {
+			excluding[i] = copyColumnName(excluding[i])
+		}
+	}
+
+	var result []string
+	for _, c := range columns {
+		if len(excluding) == 0 || notIn(c.name, excluding) && notIn(c.column, excluding) {
+			result = append(result, c.selectItem())
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+// initColumns gets the columns of the row struct, and derives "PrimaryKey", "BigColumns" and
+// "Datas" from the pgcache tags if they're empty.
+func (t *Table) initColumns() error {
+	columns, err := rowColumns(t.rowStruct)
+	if err != nil {
+		return err
+	}
+	t.rowColumns = columns
+
+	var pk, big, index []string
+	for _, c := range columns {
+		switch {
+		case c.pk:
+			pk = append(pk, c.field.Name)
+		case c.big:
+			big = append(big, c.selectItem())
+		}
+		if c.index {
+			index = append(index, c.field.Name)
+		}
+	}
+	if len(t.PrimaryKey) == 0 {
+		t.PrimaryKey = pk
+	}
+	if t.BigColumns == "" {
+		t.BigColumns = strings.Join(big, ",")
+	}
+	if len(t.Datas) == 0 && (len(pk) > 0 || len(index) > 0) {
+		return t.initTagDatas(pk, index)
+	}
+	return nil
+}
+
+func (t *Table) initTagDatas(pk, index []string) error {
+	if len(pk) == 0 {
+		return errors.New(`RowStruct: the fields of "pk" tag are required by "index" tag.`)
+	}
+	var mutex sync.RWMutex
+	var mapType = t.rowStruct
+	for i := len(pk) - 1; i >= 0; i-- {
+		keyType, err := t.tagKeyType(pk[i])
+		if err != nil {
+			return err
+		}
+		mapType = reflect.MapOf(keyType, mapType)
+	}
+	t.Datas = []*Data{{RWMutex: &mutex, DataPtr: reflect.New(mapType).Interface(), MapKeys: pk}}
+
+	for _, name := range index {
+		keyType, err := t.tagKeyType(name)
+		if err != nil {
+			return err
+		}
+		mapType := reflect.MapOf(keyType, reflect.SliceOf(t.rowStruct))
+		t.Datas = append(t.Datas, &Data{
+			RWMutex: &mutex, DataPtr: reflect.New(mapType).Interface(),
+			MapKeys: []string{name}, SortedSetUniqueKey: pk,
+		})
+	}
+	return nil
+}
+
+// tagKeyType returns the map key type of a field of "pk" or "index" tag.
+func (t *Table) tagKeyType(name string) (reflect.Type, error) {
+	field, _ := t.rowStruct.FieldByName(name)
+	typ := field.Type
+	if typ.Kind() == reflect.Slice {
+		// the row is saved under each element.
+		typ = typ.Elem()
+	}
+	if !typ.Comparable() {
+		return nil, fmt.Errorf("RowStruct.%s: type %v is not comparable to be a map key.", name, typ)
+	}
+	return typ, nil
+}
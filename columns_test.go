@@ -0,0 +1,86 @@
+package pgcache
+
+import (
+	"fmt"
+)
+
+type Pupil struct {
+	Id      int64    `pgcache:"pk"`
+	Name    string   `pgcache:"column=stuName,index"`
+	ClassID string   `db:"ClassID" pgcache:"index"`
+	Tags    []string `pgcache:"index"`
+	Bio     string   `pgcache:"big"`
+	Secret  string   `db:"-"`
+	Memo    string   `json:"-"`
+}
+
+func ExampleTable_init_tags() {
+	t := &Table{Name: "pupils", RowStruct: Pupil{}, RowStore: true}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	fmt.Println(t.Columns)
+	fmt.Println(t.BigColumns)
+	fmt.Println(t.LoadSql)
+	fmt.Println(t.bigColumnsLoadSql)
+	fmt.Println(t.PrimaryKey, t.KeyColumns("public.pupils"))
+	for _, d := range t.Datas {
+		fmt.Println(d.Key())
+	}
+
+	// the columns and their names in "Columns" are both decoded.
+	t.Create("", []byte(`{"id": 1, "stuName": "Lily", "ClassID": "A1", "tags": ["x"]}`))
+	t.Create("", []byte(`{"id": 2, "name": "Lucy", "ClassID": "A1", "tags": ["x", "y"]}`))
+	for i, key := range []interface{}{int64(1), "Lucy", "A1", "y"} {
+		value, _, _ := t.Datas[i].Get(key)
+		switch v := value.(type) {
+		case Pupil:
+			fmt.Println(v.Id, v.Name)
+		case []Pupil:
+			var names []string
+			for _, pupil := range v {
+				names = append(names, pupil.Name)
+			}
+			fmt.Println(names)
+		}
+	}
+	// Output:
+	// <nil>
+	// id,"stuName" AS name,"ClassID",tags
+	// bio
+	// SELECT id,"stuName" AS name,"ClassID",tags ,bio FROM pupils
+	// SELECT bio FROM pupils WHERE id = %s
+	// [Id] id
+	// map[Id:int64]pgcache.Pupil
+	// map[Name:string][]pgcache.Pupil
+	// map[ClassID:string][]pgcache.Pupil
+	// map[Tags:string][]pgcache.Pupil
+	// 1 Lily
+	// [Lucy]
+	// [Lily Lucy]
+	// [Lucy]
+}
+
+func ExampleTable_init_invalidTags() {
+	for _, rowStruct := range []interface{}{
+		struct {
+			Id int64 `pgcache:"primary"`
+		}{},
+		struct {
+			Id int64 `pgcache:"pk,big"`
+		}{},
+		struct {
+			Name string `pgcache:"index"`
+		}{},
+		struct {
+			Id   int64    `pgcache:"pk"`
+			Data [][]byte `pgcache:"index"`
+		}{},
+	} {
+		t := &Table{Name: "pupils", RowStruct: rowStruct}
+		fmt.Println(t.init("db", testQuerier{}, testLogger))
+	}
+	// Output:
+	// RowStruct.Id: unknown option "primary" in pgcache tag.
+	// RowStruct.Id: a pk field should not be big.
+	// RowStruct: the fields of "pk" tag are required by "index" tag.
+	// RowStruct.Data: type []uint8 is not comparable to be a map key.
+}
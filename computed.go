@@ -0,0 +1,176 @@
+package pgcache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// getter gets a map key or the value from a row. It's a field, a method or a function of the row,
+// or a composite struct key of several fields.
+type getter struct {
+	typ reflect.Type
+	// it's a single field of row struct.
+	isField bool
+	// the fields used, nil if unknown, which is the case of a method or function.
+	fields []string
+	// it's a pointer or nullable type unwrapped, the value got is invalid for NULL.
+	nullable bool
+	get      func(row reflect.Value) reflect.Value
+}
+
+// newGetter finds the getter of a name in "MapKeys" or "Value". fn is from "MapKeyFuncs" or
+// "ValueFunc", it's used if not nil. keyType is the map key type to make composite keys, it's nil
+// for "Value".
+func newGetter(rowStruct reflect.Type, name string, fn interface{}, keyType reflect.Type) (
+	*getter, error,
+) {
+	if fn != nil {
+		return funcGetter(rowStruct, fn)
+	}
+	if strings.Contains(name, ",") {
+		return compositeGetter(rowStruct, strings.Split(name, ","), keyType)
+	}
+	if field, ok := rowStruct.FieldByName(name); ok {
+		index := field.Index
+		return &getter{
+			typ: field.Type, isField: true, fields: []string{name},
+			get: func(row reflect.Value) reflect.Value { return row.FieldByIndex(index) },
+		}, nil
+	}
+	if method, ok := reflect.PtrTo(rowStruct).MethodByName(name); ok {
+		if method.Type.NumIn() != 1 || method.Type.NumOut() != 1 {
+			return nil, errors.New(`method should be of "func () T" form.`)
+		}
+		index := method.Index
+		return &getter{
+			typ: method.Type.Out(0),
+			get: func(row reflect.Value) reflect.Value { return row.Addr().Method(index).Call(nil)[0] },
+		}, nil
+	}
+	return nil, errors.New("no such field or method in row struct.")
+}
+
+func funcGetter(rowStruct reflect.Type, fn interface{}) (*getter, error) {
+	fnV := reflect.ValueOf(fn)
+	typ := fnV.Type()
+	if typ.Kind() != reflect.Func || typ.NumIn() != 1 || typ.NumOut() != 1 ||
+		typ.In(0) != rowStruct && typ.In(0) != reflect.PtrTo(rowStruct) {
+		return nil, fmt.Errorf(`function should be of "func (%v) T" or "func (*%v) T" form.`,
+			rowStruct, rowStruct)
+	}
+	isPtr := typ.In(0).Kind() == reflect.Ptr
+	return &getter{
+		typ: typ.Out(0),
+		get: func(row reflect.Value) reflect.Value {
+			if isPtr {
+				row = row.Addr()
+			}
+			return fnV.Call([]reflect.Value{row})[0]
+		},
+	}, nil
+}
+
+// compositeGetter makes a struct key, the fields of the key struct are set by the row fields of
+// the same names.
+func compositeGetter(rowStruct reflect.Type, names []string, keyType reflect.Type) (*getter, error) {
+	if keyType == nil || keyType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("composite key should be of a struct type, not %v.", keyType)
+	}
+	var rowIndexes, keyIndexes [][]int
+	for i := range names {
+		name := strings.TrimSpace(names[i])
+		rowField, ok := rowStruct.FieldByName(name)
+		if !ok {
+			return nil, fmt.Errorf("%s, no such field in row struct.", name)
+		}
+		keyField, ok := keyType.FieldByName(name)
+		if !ok {
+			return nil, fmt.Errorf("%s, no such field in key struct.", name)
+		}
+		if !rowField.Type.AssignableTo(keyField.Type) {
+			return nil, fmt.Errorf("%s, type %v is not assignable to %v.", name, rowField.Type,
+				keyField.Type)
+		}
+		names[i] = name
+		rowIndexes = append(rowIndexes, rowField.Index)
+		keyIndexes = append(keyIndexes, keyField.Index)
+	}
+	return &getter{
+		typ: keyType, fields: names,
+		get: func(row reflect.Value) reflect.Value {
+			key := reflect.New(keyType).Elem()
+			for i := range rowIndexes {
+				key.FieldByIndex(keyIndexes[i]).Set(row.FieldByIndex(rowIndexes[i]))
+			}
+			return key
+		},
+	}, nil
+}
+
+// nullableGetter returns a getter of the underlying value of a pointer or nullable type, such as
+// *int64 or sql.NullString, if the underlying type is assignable to typ. The value got is invalid
+// for NULL. It returns nil if the getter is not of such a type.
+func nullableGetter(g *getter, typ reflect.Type) *getter {
+	var underlying reflect.Type
+	var unwrap func(v reflect.Value) reflect.Value
+	if g.typ.Kind() == reflect.Ptr {
+		underlying = g.typ.Elem()
+		unwrap = func(v reflect.Value) reflect.Value {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			return v.Elem()
+		}
+	} else if valid, value, ok := nullStructFields(g.typ); ok {
+		underlying = g.typ.Field(value).Type
+		unwrap = func(v reflect.Value) reflect.Value {
+			if !v.Field(valid).Bool() {
+				return reflect.Value{}
+			}
+			return v.Field(value)
+		}
+	} else {
+		return nil
+	}
+	if !underlying.AssignableTo(typ) {
+		return nil
+	}
+	get := g.get
+	return &getter{
+		typ: underlying, fields: g.fields, nullable: true,
+		get: func(row reflect.Value) reflect.Value { return unwrap(get(row)) },
+	}
+}
+
+// nullStructFields returns the field indexes of a nullable struct like sql.NullString, which has a
+// "Valid" bool field and an exported value field.
+func nullStructFields(typ reflect.Type) (valid, value int, ok bool) {
+	if typ.Kind() != reflect.Struct || typ.NumField() != 2 {
+		return 0, 0, false
+	}
+	field, ok := typ.FieldByName("Valid")
+	if !ok || field.Type.Kind() != reflect.Bool || len(field.Index) != 1 {
+		return 0, 0, false
+	}
+	valid, value = field.Index[0], 1-field.Index[0]
+	return valid, value, typ.Field(value).PkgPath == ""
+}
+
+// initValueGetter finds the getter of "Value" or "ValueFunc", and returns the value type.
+func (d *Data) initValueGetter(rowStruct reflect.Type) (reflect.Type, error) {
+	d.valueGetter = nil
+	if d.Value == "" && d.ValueFunc == nil {
+		return rowStruct, nil
+	}
+	g, err := newGetter(rowStruct, d.Value, d.ValueFunc, nil)
+	if err != nil {
+		if d.ValueFunc != nil {
+			return nil, fmt.Errorf("Data.ValueFunc: %v", err)
+		}
+		return nil, fmt.Errorf("Data.Value: %s, %v", d.Value, err)
+	}
+	d.valueGetter = g
+	return g.typ, nil
+}
@@ -0,0 +1,107 @@
+package pgcache
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type Account struct {
+	Id        int
+	FirstName string
+	LastName  string
+	Email     string
+}
+
+func (a Account) LowerEmail() string {
+	return strings.ToLower(a.Email)
+}
+
+func (a *Account) Domains() []string {
+	return []string{a.Email[strings.Index(a.Email, "@")+1:]}
+}
+
+type AccountName struct {
+	FirstName, LastName string
+}
+
+type AccountDTO struct {
+	Id   int
+	Name string
+}
+
+func ExampleData_computed() {
+	var byEmail map[string]int
+	var byUpperName map[string]map[int]*AccountDTO
+	var byName map[AccountName]int
+	var byDomain map[string][]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "accounts", RowStruct: Account{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &byEmail, MapKeys: []string{"LowerEmail"}, Value: "Id"},
+			{RWMutex: &mutex, DataPtr: &byUpperName, MapKeys: []string{"UpperName", "Id"},
+				MapKeyFuncs: map[string]interface{}{
+					"UpperName": func(a Account) string { return strings.ToUpper(a.FirstName) },
+				},
+				Value: "DTO", ValueFunc: func(a *Account) AccountDTO {
+					return AccountDTO{Id: a.Id, Name: a.FirstName + " " + a.LastName}
+				},
+			},
+			{RWMutex: &mutex, DataPtr: &byName, MapKeys: []string{"FirstName, LastName"}, Value: "Id"},
+			{RWMutex: &mutex, DataPtr: &byDomain, MapKeys: []string{"Domains"}, Value: "Id"},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+	t.Create("", []byte(`{"Id": 1, "FirstName": "Li", "LastName": "Lei", "Email": "Li@A.com"}`))
+	t.Create("", []byte(`{"Id": 2, "FirstName": "Han", "LastName": "Meimei", "Email": "han@a.com"}`))
+	t.Update("",
+		[]byte(`{"Id": 2, "FirstName": "Han", "LastName": "Meimei", "Email": "han@a.com"}`),
+		[]byte(`{"Id": 2, "FirstName": "Han", "LastName": "Mei", "Email": "han@b.com"}`),
+	)
+	fmt.Println(byEmail)
+	fmt.Println(*byUpperName["LI"][1], *byUpperName["HAN"][2])
+	fmt.Println(byName)
+	fmt.Println(byDomain)
+	fmt.Println(t.Datas[1].Key(), t.Datas[1].alwaysUpdate, t.Datas[2].alwaysUpdate)
+
+	// Output:
+	// <nil>
+	// map[han@b.com:2 li@a.com:1]
+	// {1 Li Lei} {2 Han Mei}
+	// map[{Han Mei}:2 {Li Lei}:1]
+	// map[A.com:[1] b.com:[2]]
+	// map[UpperName:string]map[Id:int]DTO:*pgcache.AccountDTO true false
+}
+
+func ExampleData_init_invalidComputed() {
+	var mutex sync.RWMutex
+	var m1 map[string]int
+	var m2 map[AccountName]int
+	var m3 map[int]int
+	for _, d := range []*Data{
+		{RWMutex: &mutex, DataPtr: &m1, MapKeys: []string{"Email"},
+			MapKeyFuncs: map[string]interface{}{"Name": func(a Account) string { return "" }}},
+		{RWMutex: &mutex, DataPtr: &m1, MapKeys: []string{"Email"},
+			MapKeyFuncs: map[string]interface{}{"Email": func(a Account) {}}},
+		{RWMutex: &mutex, DataPtr: &m3, MapKeys: []string{"LowerEmail"}},
+		{RWMutex: &mutex, DataPtr: &m1, MapKeys: []string{"FirstName,LastName"}},
+		{RWMutex: &mutex, DataPtr: &m2, MapKeys: []string{"FirstName,Email"}},
+		{RWMutex: &mutex, DataPtr: &m2, MapKeys: []string{"FirstName,Nick"}},
+		{RWMutex: &mutex, DataPtr: &m1, MapKeys: []string{"Email"}, ValueFunc: func(a Account) string { return "" }},
+		{RWMutex: &mutex, DataPtr: &m1, MapKeys: []string{"Email"}, Value: "Name"},
+	} {
+		fmt.Println(d.init(reflect.TypeOf(Account{})))
+	}
+	// Output:
+	// Data.MapKeyFuncs: Name, is not in Data.MapKeys.
+	// Data.MapKeys[0]: Email, function should be of "func (pgcache.Account) T" or "func (*pgcache.Account) T" form.
+	// Data.MapKeys[0]: LowerEmail, type string is not assignable to int.
+	// Data.MapKeys[0]: FirstName,LastName, composite key should be of a struct type, not string.
+	// Data.MapKeys[0]: FirstName,Email, Email, no such field in key struct.
+	// Data.MapKeys[0]: FirstName,Nick, Nick, no such field in row struct.
+	// Data.Value: , type string is not assignable to int.
+	// Data.Value: Name, no such field or method in row struct.
+}
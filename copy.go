@@ -0,0 +1,467 @@
+package pgcache
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// CopyQuerier is implemented by a DBQuerier which can run a "COPY ... TO STDOUT" sql, and write
+// the raw COPY output to "w". It's required if "Table.CopyFormat" is not empty. "lib/pq" can't run
+// "COPY ... TO STDOUT", so it should be implemented by a driver which can, such as "CopyTo" of
+// "github.com/jackc/pgx/v4/pgconn".
+type CopyQuerier interface {
+	CopyTo(w io.Writer, sql string) error
+}
+
+// a column of the COPY output and the row struct field to store it.
+type copyField struct {
+	column string
+	index  []int
+	text   func(field reflect.Value, buf []byte) error
+	binary func(field reflect.Value, buf []byte) error
+}
+
+var copyBinarySignature = []byte("PGCOPY\n\377\r\n\000")
+
+// postgres epoch of binary timestamp and date
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+var timeType = reflect.TypeOf(time.Time{})
+
+func (t *Table) copyLoad(rows reflect.Value) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(t.dbQuerier.(CopyQuerier).CopyTo(writer, t.copySql))
+	}()
+	err := t.decodeCopy(bufio.NewReaderSize(reader, 64*1024), rows)
+	reader.CloseWithError(err) // let CopyTo stop if decoding failed.
+	return err
+}
+
+func (t *Table) decodeCopy(reader *bufio.Reader, rows reflect.Value) error {
+	if t.CopyFormat == "binary" {
+		return decodeCopyBinary(reader, rows, t.copyFields)
+	}
+	return decodeCopyText(reader, rows, t.copyFields)
+}
+
+func decodeCopyText(reader *bufio.Reader, rows reflect.Value, fields []copyField) error {
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			var buf = append([]byte(nil), line...)
+			for err == bufio.ErrBufferFull {
+				line, err = reader.ReadSlice('\n')
+				buf = append(buf, line...)
+			}
+			line = buf
+		}
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if bytes.Equal(line, []byte(`\.`)) {
+			return nil
+		}
+
+		row := reflect.New(rows.Type().Elem()).Elem()
+		if err := decodeCopyTextRow(line, row, fields); err != nil {
+			return err
+		}
+		rows.Set(reflect.Append(rows, row))
+	}
+}
+
+func decodeCopyTextRow(line []byte, row reflect.Value, fields []copyField) error {
+	for i := range fields {
+		var value []byte
+		if i < len(fields)-1 {
+			index := bytes.IndexByte(line, '\t')
+			if index < 0 {
+				return fmt.Errorf("copy: expect %d columns, got %d.", len(fields), i+1)
+			}
+			value, line = line[:index], line[index+1:]
+		} else {
+			if bytes.IndexByte(line, '\t') >= 0 {
+				return fmt.Errorf("copy: expect %d columns, got more.", len(fields))
+			}
+			value = line
+		}
+		field := row.FieldByIndex(fields[i].index)
+		if bytes.Equal(value, []byte(`\N`)) {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+		if err := fields[i].text(field, copyTextUnescape(value)); err != nil {
+			return fmt.Errorf("copy: column %s: %v", fields[i].column, err)
+		}
+	}
+	return nil
+}
+
+func copyTextUnescape(value []byte) []byte {
+	if bytes.IndexByte(value, '\\') < 0 {
+		return value
+	}
+	var result = make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c != '\\' || i == len(value)-1 {
+			result = append(result, c)
+			continue
+		}
+		i++
+		switch c = value[i]; c {
+		case 'b':
+			result = append(result, '\b')
+		case 'f':
+			result = append(result, '\f')
+		case 'n':
+			result = append(result, '\n')
+		case 'r':
+			result = append(result, '\r')
+		case 't':
+			result = append(result, '\t')
+		case 'v':
+			result = append(result, '\v')
+		case 'x':
+			j := i + 1
+			for ; j < len(value) && j < i+3 && isHexDigit(value[j]); j++ {
+			}
+			if j == i+1 {
+				result = append(result, 'x')
+				continue
+			}
+			n, _ := strconv.ParseUint(string(value[i+1:j]), 16, 8)
+			result = append(result, byte(n))
+			i = j - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for ; j < len(value) && j < i+3 && value[j] >= '0' && value[j] <= '7'; j++ {
+			}
+			n, _ := strconv.ParseUint(string(value[i:j]), 8, 8)
+			result = append(result, byte(n))
+			i = j - 1
+		default:
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func decodeCopyBinary(reader *bufio.Reader, rows reflect.Value, fields []copyField) error {
+	var header [19]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return fmt.Errorf("copy: read header: %v", err)
+	}
+	if !bytes.Equal(header[:11], copyBinarySignature) {
+		return errors.New("copy: invalid binary signature.")
+	}
+	if _, err := reader.Discard(int(binary.BigEndian.Uint32(header[15:]))); err != nil {
+		return fmt.Errorf("copy: read header extension: %v", err)
+	}
+
+	var buf []byte
+	for {
+		var count int16
+		if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
+			return fmt.Errorf("copy: read tuple: %v", err)
+		}
+		if count == -1 {
+			return nil
+		}
+		if int(count) != len(fields) {
+			return fmt.Errorf("copy: expect %d columns, got %d.", len(fields), count)
+		}
+		row := reflect.New(rows.Type().Elem()).Elem()
+		for i := range fields {
+			var length int32
+			if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+				return fmt.Errorf("copy: read field: %v", err)
+			}
+			field := row.FieldByIndex(fields[i].index)
+			if length < 0 {
+				field.Set(reflect.Zero(field.Type()))
+				continue
+			}
+			if cap(buf) < int(length) {
+				buf = make([]byte, length)
+			}
+			buf = buf[:length]
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				return fmt.Errorf("copy: read field: %v", err)
+			}
+			if err := fields[i].binary(field, buf); err != nil {
+				return fmt.Errorf("copy: column %s: %v", fields[i].column, err)
+			}
+		}
+		rows.Set(reflect.Append(rows, row))
+	}
+}
+
+// copyColumnName returns the output column name of a select list item.
+func copyColumnName(column string) string {
+	column = strings.TrimSpace(column)
+	if index := strings.LastIndex(strings.ToLower(column), " as "); index >= 0 {
+		column = strings.TrimSpace(column[index+4:])
+	} else if index := strings.LastIndexByte(column, '.'); index >= 0 {
+		column = column[index+1:]
+	}
+	return strings.Trim(column, `"`)
+}
+
+func copyTextDecoder(typ reflect.Type) func(reflect.Value, []byte) error {
+	if reflect.PtrTo(typ).Implements(scannerType) {
+		return func(field reflect.Value, buf []byte) error {
+			return field.Addr().Interface().(sql.Scanner).Scan(append([]byte(nil), buf...))
+		}
+	}
+	if typ == timeType {
+		return func(field reflect.Value, buf []byte) error {
+			t, err := pq.ParseTimestamp(time.Local, string(buf))
+			if err == nil {
+				field.Set(reflect.ValueOf(t))
+			}
+			return err
+		}
+	}
+	switch typ.Kind() {
+	case reflect.Ptr:
+		elemDecoder := copyTextDecoder(typ.Elem())
+		return func(field reflect.Value, buf []byte) error {
+			elem := reflect.New(typ.Elem())
+			if err := elemDecoder(elem.Elem(), buf); err != nil {
+				return err
+			}
+			field.Set(elem)
+			return nil
+		}
+	case reflect.String:
+		return func(field reflect.Value, buf []byte) error {
+			field.SetString(string(buf))
+			return nil
+		}
+	case reflect.Bool:
+		return func(field reflect.Value, buf []byte) error {
+			field.SetBool(len(buf) > 0 && buf[0] == 't')
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(field reflect.Value, buf []byte) error {
+			n, err := strconv.ParseInt(string(buf), 10, typ.Bits())
+			if err == nil {
+				field.SetInt(n)
+			}
+			return err
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(field reflect.Value, buf []byte) error {
+			n, err := strconv.ParseUint(string(buf), 10, typ.Bits())
+			if err == nil {
+				field.SetUint(n)
+			}
+			return err
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(field reflect.Value, buf []byte) error {
+			n, err := strconv.ParseFloat(string(buf), typ.Bits())
+			if err == nil {
+				field.SetFloat(n)
+			}
+			return err
+		}
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return func(field reflect.Value, buf []byte) error {
+				if !bytes.HasPrefix(buf, []byte(`\x`)) {
+					field.SetBytes(append([]byte(nil), buf...))
+					return nil
+				}
+				b := make([]byte, hex.DecodedLen(len(buf)-2))
+				if _, err := hex.Decode(b, buf[2:]); err != nil {
+					return err
+				}
+				field.SetBytes(b)
+				return nil
+			}
+		}
+		return func(field reflect.Value, buf []byte) error {
+			if len(buf) > 0 && buf[0] == '{' {
+				return pq.Array(field.Addr().Interface()).Scan(buf)
+			}
+			return json.Unmarshal(buf, field.Addr().Interface())
+		}
+	default:
+		return func(field reflect.Value, buf []byte) error {
+			return json.Unmarshal(buf, field.Addr().Interface())
+		}
+	}
+}
+
+// copyBinaryDecoder returns the decoder of a binary column of the PostgreSQL type into a field of
+// the Go type, or nil if it's not supported.
+func copyBinaryDecoder(pgType string, typ reflect.Type) func(reflect.Value, []byte) error {
+	if reflect.PtrTo(typ).Implements(scannerType) {
+		return nil
+	}
+	if typ == timeType {
+		return copyBinaryTimeDecoder(pgType)
+	}
+	switch typ.Kind() {
+	case reflect.Ptr:
+		elemDecoder := copyBinaryDecoder(pgType, typ.Elem())
+		if elemDecoder == nil {
+			return nil
+		}
+		return func(field reflect.Value, buf []byte) error {
+			elem := reflect.New(typ.Elem())
+			if err := elemDecoder(elem.Elem(), buf); err != nil {
+				return err
+			}
+			field.Set(elem)
+			return nil
+		}
+	case reflect.String:
+		switch pgType {
+		case "text", "varchar", "bpchar", "name", "citext", "json", "jsonb":
+			return func(field reflect.Value, buf []byte) error {
+				if pgType == "jsonb" && len(buf) > 0 {
+					buf = buf[1:] // the version byte
+				}
+				field.SetString(string(buf))
+				return nil
+			}
+		}
+	case reflect.Bool:
+		if pgType == "bool" {
+			return func(field reflect.Value, buf []byte) error {
+				field.SetBool(len(buf) > 0 && buf[0] != 0)
+				return nil
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if isPGIntType(pgType) {
+			return func(field reflect.Value, buf []byte) error {
+				n, err := copyBinaryInt(buf)
+				if err == nil {
+					field.SetInt(n)
+				}
+				return err
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if isPGIntType(pgType) {
+			return func(field reflect.Value, buf []byte) error {
+				n, err := copyBinaryInt(buf)
+				if err == nil && n < 0 {
+					err = fmt.Errorf("negative value %d for type %v", n, typ)
+				}
+				if err == nil {
+					field.SetUint(uint64(n))
+				}
+				return err
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if pgType == "float4" || pgType == "float8" {
+			return func(field reflect.Value, buf []byte) error {
+				switch len(buf) {
+				case 4:
+					field.SetFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(buf))))
+				case 8:
+					field.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(buf)))
+				default:
+					return fmt.Errorf("unexpected float length: %d", len(buf))
+				}
+				return nil
+			}
+		}
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 && pgType == "bytea" {
+			return func(field reflect.Value, buf []byte) error {
+				field.SetBytes(append([]byte(nil), buf...))
+				return nil
+			}
+		}
+	case reflect.Struct, reflect.Map:
+		if pgType == "json" || pgType == "jsonb" {
+			return func(field reflect.Value, buf []byte) error {
+				if pgType == "jsonb" && len(buf) > 0 {
+					buf = buf[1:] // the version byte
+				}
+				return json.Unmarshal(buf, field.Addr().Interface())
+			}
+		}
+	}
+	return nil
+}
+
+// copyBinaryTimeDecoder returns the decoder of a binary time column. The times are in the local
+// time zone, as "pq.ParseTimestamp(time.Local, ...)" of the text format makes them. So a timestamp
+// or a date is the local wall clock time, and a timestamptz is the same instant.
+func copyBinaryTimeDecoder(pgType string) func(reflect.Value, []byte) error {
+	switch pgType {
+	case "timestamp", "timestamptz":
+		return func(field reflect.Value, buf []byte) error {
+			if len(buf) != 8 {
+				return fmt.Errorf("unexpected %s length: %d", pgType, len(buf))
+			}
+			t := pgEpoch.Add(time.Duration(int64(binary.BigEndian.Uint64(buf))) * time.Microsecond)
+			if pgType == "timestamp" {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(),
+					t.Nanosecond(), time.Local)
+			}
+			field.Set(reflect.ValueOf(t.Local()))
+			return nil
+		}
+	case "date":
+		return func(field reflect.Value, buf []byte) error {
+			if len(buf) != 4 {
+				return fmt.Errorf("unexpected date length: %d", len(buf))
+			}
+			t := pgEpoch.AddDate(0, 0, int(int32(binary.BigEndian.Uint32(buf))))
+			field.Set(reflect.ValueOf(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)))
+			return nil
+		}
+	}
+	return nil
+}
+
+func isPGIntType(pgType string) bool {
+	return pgType == "int2" || pgType == "int4" || pgType == "int8"
+}
+
+func copyBinaryInt(buf []byte) (int64, error) {
+	switch len(buf) {
+	case 2:
+		return int64(int16(binary.BigEndian.Uint16(buf))), nil
+	case 4:
+		return int64(int32(binary.BigEndian.Uint32(buf))), nil
+	case 8:
+		return int64(binary.BigEndian.Uint64(buf)), nil
+	default:
+		return 0, fmt.Errorf("unexpected integer length: %d", len(buf))
+	}
+}
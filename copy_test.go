@@ -0,0 +1,387 @@
+package pgcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lovego/bsql"
+)
+
+type testCopyQuerier struct {
+	testQuerier
+	data    []byte
+	pgTypes []pgColumnType
+}
+
+var testScoresPGTypes = []pgColumnType{
+	{Name: "student_id", Type: "int8"}, {Name: "subject", Type: "varchar"}, {Name: "score", Type: "int4"},
+}
+
+func (q testCopyQuerier) Query(data interface{}, sql string, args ...interface{}) error {
+	if v, ok := data.(*[]pgColumnType); ok {
+		if *v = q.pgTypes; *v == nil {
+			*v = testScoresPGTypes
+		}
+		return nil
+	}
+	return q.testQuerier.Query(data, sql, args...)
+}
+
+func (q testCopyQuerier) CopyTo(w io.Writer, sql string) error {
+	_, err := w.Write(q.data)
+	return err
+}
+
+func ExampleTable_copyLoad_text() {
+	var m map[int]map[string]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name:       "scores",
+		RowStruct:  Score{},
+		CopyFormat: "text",
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	fmt.Println(t.init("db", testCopyQuerier{data: []byte(
+		"1001\t语文\t90\n1001\t\\x41\\102\t\\N\n1002\t\\N\t80\n",
+	)}, testLogger))
+	fmt.Println(t.copySql)
+	fmt.Println(t.Reload(false))
+	fmt.Println(m)
+	// Output:
+	// <nil>
+	// COPY (SELECT student_id,subject,score  FROM scores) TO STDOUT
+	// <nil>
+	// map[1001:map[AB:0 语文:90] 1002:map[:80]]
+}
+
+func ExampleTable_copyLoad_binary() {
+	var m map[int]map[string]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name:       "scores",
+		RowStruct:  Score{},
+		CopyFormat: "binary",
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	fmt.Println(t.init("db", testCopyQuerier{data: testCopyBinaryScores([]Score{
+		{StudentId: 1001, Subject: "语文", Score: 90},
+		{StudentId: 1002, Subject: "数学", Score: 80},
+	})}, testLogger))
+	fmt.Println(t.copySql)
+	fmt.Println(t.Reload(false))
+	fmt.Println(m)
+	// Output:
+	// <nil>
+	// COPY (SELECT student_id,subject,score  FROM scores) TO STDOUT WITH (FORMAT binary)
+	// <nil>
+	// map[1001:map[语文:90] 1002:map[数学:80]]
+}
+
+func ExampleTable_initCopy() {
+	var mutex sync.RWMutex
+	var m map[int]Score
+	datas := []*Data{{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}}}
+
+	t := &Table{Name: "scores", RowStruct: Score{}, CopyFormat: "text", Datas: datas}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+
+	t = &Table{Name: "scores", RowStruct: Score{}, CopyFormat: "csv", Datas: datas}
+	fmt.Println(t.init("db", testCopyQuerier{}, testLogger))
+
+	t = &Table{
+		Name: "scores", RowStruct: Score{}, CopyFormat: "text", Datas: datas,
+		Columns: "student_id, subject AS course",
+	}
+	fmt.Println(t.init("db", testCopyQuerier{}, testLogger))
+
+	t = &Table{Name: "scores", RowStruct: Score{}, CopyFormat: "binary", Datas: datas}
+	fmt.Println(t.init("db", testCopyQuerier{pgTypes: []pgColumnType{
+		{Name: "student_id", Type: "int8"}, {Name: "subject", Type: "uuid"}, {Name: "score", Type: "int4"},
+	}}, testLogger))
+
+	t = &Table{
+		Name: "scores", RowStruct: Score{}, CopyFormat: "binary", Datas: datas,
+		Columns: "student_id, upper(name) AS subject, score",
+	}
+	fmt.Println(t.init("db", testCopyQuerier{pgTypes: []pgColumnType{
+		{Name: "student_id", Type: "int8"}, {Name: "score", Type: "int4"},
+	}}, testLogger))
+	// Output:
+	// CopyFormat: the db querier is not a CopyQuerier.
+	// CopyFormat: csv, should be "text" or "binary".
+	// CopyFormat: column "course" has no matching field in RowStruct.
+	// CopyFormat: column "subject", binary format of type "uuid" is not supported for string.
+	// CopyFormat: column "subject" is not a column of scores, its binary format is unknown.
+}
+
+func Example_copyTextDecoder() {
+	type T struct {
+		Bytes []byte
+		Ints  []int64
+		Time  time.Time
+		Ptr   *string
+		Bool  bool
+		Float float64
+		Map   map[string]int
+	}
+	var rows []T
+	err := decodeCopyText(bufioReader(
+		`\\x6869	{1,2}	2003-10-01 09:10:10+08	a\nb	t	1.5	{"a": 1}`+"\n\\.\n",
+	), reflect.ValueOf(&rows).Elem(), testCopyFields(reflect.TypeOf(T{})))
+	fmt.Println(err)
+	fmt.Printf("%s %v %v %q %v %v %v\n", rows[0].Bytes, rows[0].Ints,
+		rows[0].Time.UTC().Format(time.RFC3339), *rows[0].Ptr, rows[0].Bool, rows[0].Float, rows[0].Map,
+	)
+	// Output:
+	// <nil>
+	// hi [1 2] 2003-10-01T01:10:10Z "a\nb" true 1.5 map[a:1]
+}
+
+func Example_copyBinaryDecoder() {
+	var v struct {
+		Time time.Time
+		Str  string
+		Uint uint
+	}
+	row := reflect.ValueOf(&v).Elem()
+	microseconds := func(d time.Duration) []byte {
+		var b = make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(d/time.Microsecond))
+		return b
+	}
+
+	// a timestamp is the local wall clock time, as the text format.
+	fmt.Println(copyBinaryDecoder("timestamp", timeType)(row.Field(0), microseconds(time.Hour)))
+	fmt.Println(v.Time.Location() == time.Local, v.Time.Format("2006-01-02 15:04:05"))
+	fmt.Println(copyBinaryDecoder("timestamptz", timeType)(row.Field(0), microseconds(time.Hour)))
+	fmt.Println(v.Time.Location() == time.Local, v.Time.UTC().Format("2006-01-02 15:04:05"))
+	fmt.Println(copyBinaryDecoder("date", timeType)(row.Field(0), []byte{0, 0, 0, 1}))
+	fmt.Println(v.Time.Location() == time.Local, v.Time.Format("2006-01-02 15:04:05"))
+
+	fmt.Println(copyBinaryDecoder("jsonb", reflect.TypeOf(""))(row.Field(1), []byte("\x01{\"a\": 1}")))
+	fmt.Println(v.Str)
+	fmt.Println(copyBinaryDecoder("int4", reflect.TypeOf(uint(0)))(row.Field(2), []byte{255, 255, 255, 255}))
+
+	fmt.Println(copyBinaryDecoder("uuid", reflect.TypeOf("")) == nil)
+	fmt.Println(copyBinaryDecoder("numeric", reflect.TypeOf(0.0)) == nil)
+	fmt.Println(copyBinaryDecoder("", reflect.TypeOf(0)) == nil)
+	fmt.Println(copyBinaryDecoder("text", reflect.TypeOf(sql.NullString{})) == nil)
+	// Output:
+	// <nil>
+	// true 2000-01-01 01:00:00
+	// <nil>
+	// true 2000-01-01 01:00:00
+	// <nil>
+	// true 2000-01-02 00:00:00
+	// <nil>
+	// {"a": 1}
+	// negative value -1 for type uint
+	// true
+	// true
+	// true
+	// true
+}
+
+func Example_copyColumnName() {
+	fmt.Println(copyColumnName(" id "))
+	fmt.Println(copyColumnName(`s.name`))
+	fmt.Println(copyColumnName(`to_char(time, 'YYYY') AS "time"`))
+	// Output:
+	// id
+	// name
+	// time
+}
+
+func bufioReader(s string) *bufio.Reader {
+	return bufio.NewReader(strings.NewReader(s))
+}
+
+func testCopyFields(rowStruct reflect.Type) []copyField {
+	var fields []copyField
+	for i := 0; i < rowStruct.NumField(); i++ {
+		field := rowStruct.Field(i)
+		fields = append(fields, copyField{
+			column: Field2Column(field.Name), index: field.Index,
+			text: copyTextDecoder(field.Type),
+		})
+	}
+	return fields
+}
+
+func testCopyBinaryScores(scores []Score) []byte {
+	var buf bytes.Buffer
+	buf.Write(copyBinarySignature)
+	binary.Write(&buf, binary.BigEndian, [2]int32{0, 0})
+	for _, score := range scores {
+		binary.Write(&buf, binary.BigEndian, int16(3))
+		binary.Write(&buf, binary.BigEndian, int32(8))
+		binary.Write(&buf, binary.BigEndian, int64(score.StudentId))
+		binary.Write(&buf, binary.BigEndian, int32(len(score.Subject)))
+		buf.WriteString(score.Subject)
+		binary.Write(&buf, binary.BigEndian, int32(4))
+		binary.Write(&buf, binary.BigEndian, int32(score.Score))
+	}
+	binary.Write(&buf, binary.BigEndian, int16(-1))
+	return buf.Bytes()
+}
+
+func testScores(n int) []Score {
+	var scores = make([]Score, n)
+	for i := range scores {
+		scores[i] = Score{StudentId: i, Subject: "语文" + strconv.Itoa(i%10), Score: i % 100}
+	}
+	return scores
+}
+
+const benchRowsCount = 10000
+
+func BenchmarkReload_query(b *testing.B) {
+	db := sql.OpenDB(benchConnector{testScores(benchRowsCount)})
+	benchmarkReload(b, "", bsql.New(db, time.Minute))
+}
+
+func BenchmarkReload_copyText(b *testing.B) {
+	var buf bytes.Buffer
+	for _, score := range testScores(benchRowsCount) {
+		fmt.Fprintf(&buf, "%d\t%s\t%d\n", score.StudentId, score.Subject, score.Score)
+	}
+	benchmarkReload(b, "text", benchCopyQuerier{buf.Bytes()})
+}
+
+func BenchmarkReload_copyBinary(b *testing.B) {
+	benchmarkReload(b, "binary", benchCopyQuerier{testCopyBinaryScores(testScores(benchRowsCount))})
+}
+
+func benchmarkReload(b *testing.B, copyFormat string, querier DBQuerier) {
+	var m map[int]Score
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{}, CopyFormat: copyFormat,
+		Datas: []*Data{{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}}},
+	}
+	if err := t.init("db", querier, testLogger); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var rows []Score
+		var err error
+		if copyFormat != "" {
+			err = t.copyLoad(reflect.ValueOf(&rows).Elem())
+		} else {
+			err = t.dbQuerier.Query(&rows, t.LoadSql)
+		}
+		if err != nil || len(rows) != benchRowsCount {
+			b.Fatal(err, len(rows))
+		}
+	}
+}
+
+type benchCopyQuerier struct {
+	data []byte
+}
+
+func (q benchCopyQuerier) Query(data interface{}, sql string, args ...interface{}) error {
+	if v, ok := data.(*[]pgColumnType); ok {
+		*v = testScoresPGTypes
+	}
+	return nil
+}
+
+func (q benchCopyQuerier) GetDB() *sql.DB {
+	return nil
+}
+
+func (q benchCopyQuerier) CopyTo(w io.Writer, sql string) error {
+	_, err := w.Write(q.data)
+	return err
+}
+
+// benchConnector is a fake sql driver which returns scores for every query,
+// so that the reflection scanning of bsql can be benchmarked without a database.
+type benchConnector struct {
+	scores []Score
+}
+
+func (c benchConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return benchConn{c.scores}, nil
+}
+
+func (c benchConnector) Driver() driver.Driver {
+	return nil
+}
+
+type benchConn struct {
+	scores []Score
+}
+
+func (c benchConn) Prepare(query string) (driver.Stmt, error) {
+	return benchStmt{c.scores}, nil
+}
+
+func (c benchConn) Close() error {
+	return nil
+}
+
+func (c benchConn) Begin() (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
+
+type benchStmt struct {
+	scores []Score
+}
+
+func (s benchStmt) Close() error {
+	return nil
+}
+
+func (s benchStmt) NumInput() int {
+	return -1
+}
+
+func (s benchStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+
+func (s benchStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &benchDriverRows{scores: s.scores}, nil
+}
+
+type benchDriverRows struct {
+	scores []Score
+	i      int
+}
+
+func (r *benchDriverRows) Columns() []string {
+	return []string{"student_id", "subject", "score"}
+}
+
+func (r *benchDriverRows) Close() error {
+	return nil
+}
+
+func (r *benchDriverRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.scores) {
+		return io.EOF
+	}
+	score := r.scores[r.i]
+	dest[0], dest[1], dest[2] = int64(score.StudentId), []byte(score.Subject), int64(score.Score)
+	r.i++
+	return nil
+}
@@ -0,0 +1,163 @@
+package pgcache
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// copy-on-write snapshot of a Data, see "Data.Snapshot".
+type cowData struct {
+	// the published container, it's never modified after published.
+	value atomic.Value
+	// the top level map keys changed since the last publish.
+	dirty map[interface{}]bool
+	// all keys are changed since the last publish.
+	dirtyAll bool
+	// a delayed publish is scheduled.
+	pending bool
+	// the copy time and the end time of the last publish.
+	cost        time.Duration
+	publishedAt time.Time
+}
+
+// If a publish copies longer than cowBatchCost, and "SnapshotDelay" is not set, the next publish is
+// delayed until cowDelayRatio times of the copy time later, so the changes meanwhile are batched,
+// and copying takes at most about 1/(cowDelayRatio+1) of the time.
+const (
+	cowBatchCost  = time.Millisecond
+	cowDelayRatio = 9
+)
+
+func (d *Data) initSnapshot(lazy bool) error {
+	if !d.Snapshot {
+		if d.SnapshotDelay != 0 {
+			return errors.New("Data.SnapshotDelay should be zero, if Data.Snapshot is false.")
+		}
+		return nil
+	}
+	if lazy {
+		return errors.New("Data.Snapshot is not supported for a lazy table.")
+	}
+	if d.index != nil || d.search != nil || d.sharded != nil {
+		return errors.New("Data.Snapshot: Data.DataPtr should be a map or slice.")
+	}
+	d.snapshot = &cowData{dirty: make(map[interface{}]bool)}
+	d.snapshot.value.Store(cloneContainer(d.dataV).Interface())
+	return nil
+}
+
+// Load returns the latest published snapshot of the map or slice of "DataPtr" without any lock, if
+// "Snapshot" is true. It must not be modified. If "Snapshot" is false, it returns nil.
+func (d *Data) Load() interface{} {
+	if d.snapshot == nil {
+		return nil
+	}
+	return d.snapshot.value.Load()
+}
+
+// touch records the top level map keys of the row as changed. It should be called with the lock held.
+func (d *Data) touch(row reflect.Value) {
+	s := d.snapshot
+	if s == nil || s.dirtyAll {
+		return
+	}
+	if d.dataV.Kind() == reflect.Slice {
+		s.dirtyAll = true
+		return
+	}
+	for _, keys := range d.mapKeys(row) {
+		s.dirty[keys[0].Interface()] = true
+	}
+}
+
+// touchAll records all keys as changed. It should be called with the lock held.
+func (d *Data) touchAll() {
+	if d.snapshot != nil {
+		d.snapshot.dirtyAll = true
+	}
+}
+
+// publish publishes the changes, immediately or after "SnapshotDelay", or in batches if the copy
+// is slow. It should be called with the lock held.
+func (d *Data) publish() {
+	s := d.snapshot
+	if s == nil || !s.dirtyAll && len(s.dirty) == 0 {
+		return
+	}
+	delay := d.SnapshotDelay
+	if delay <= 0 {
+		if s.cost < cowBatchCost {
+			d.publishNow()
+			return
+		}
+		if delay = cowDelayRatio*s.cost - time.Since(s.publishedAt); delay <= 0 {
+			d.publishNow()
+			return
+		}
+	}
+	if s.pending {
+		return
+	}
+	s.pending = true
+	time.AfterFunc(delay, func() {
+		d.Lock()
+		defer d.Unlock()
+		d.publishNow()
+	})
+}
+
+// publishNow should be called with the lock held.
+func (d *Data) publishNow() {
+	s := d.snapshot
+	s.pending = false
+	start := time.Now()
+	if s.dirtyAll || d.dataV.Kind() == reflect.Slice || d.dataV.IsNil() {
+		s.value.Store(cloneContainer(d.dataV).Interface())
+	} else {
+		// the unchanged values are shared with the previous snapshot.
+		prev := reflect.ValueOf(s.value.Load())
+		next := reflect.MakeMapWithSize(d.dataV.Type(), d.dataV.Len())
+		if !prev.IsNil() {
+			for iter := prev.MapRange(); iter.Next(); {
+				next.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+		for key := range s.dirty {
+			keyV := reflect.ValueOf(key)
+			next.SetMapIndex(keyV, cloneContainer(d.dataV.MapIndex(keyV)))
+		}
+		s.value.Store(next.Interface())
+	}
+	s.dirty, s.dirtyAll = make(map[interface{}]bool), false
+	s.publishedAt = time.Now()
+	s.cost = s.publishedAt.Sub(start)
+}
+
+// cloneContainer returns a deep copy of the maps and slices of v. An invalid v is returned as is,
+// so it deletes the key when used by SetMapIndex.
+func cloneContainer(v reflect.Value) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		result := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			result.SetMapIndex(iter.Key(), cloneContainer(iter.Value()))
+		}
+		return result
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		result := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(result, v)
+		return result
+	}
+	return v
+}
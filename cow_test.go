@@ -0,0 +1,213 @@
+package pgcache
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func ExampleData_Load() {
+	var m map[string]map[int]int
+	var slice []int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"Subject", "StudentId"}, Value: "Score",
+				Snapshot: true},
+			{RWMutex: &mutex, DataPtr: &slice, Value: "Score", Snapshot: true},
+		},
+	}
+	fmt.Println(t.Datas[0].Load())
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "数学", "Score": 95}`))
+	v1 := t.Datas[0].Load().(map[string]map[int]int)
+	fmt.Println(v1, t.Datas[1].Load())
+
+	t.Update("",
+		[]byte(`{"StudentId": 1001, "Subject": "数学", "Score": 95}`),
+		[]byte(`{"StudentId": 1001, "Subject": "数学", "Score": 98}`),
+	)
+	v2 := t.Datas[0].Load().(map[string]map[int]int)
+	fmt.Println(v1, v2, t.Datas[1].Load())
+	// the unchanged map value is shared.
+	fmt.Println(
+		reflect.ValueOf(v1["语文"]).Pointer() == reflect.ValueOf(v2["语文"]).Pointer(),
+		reflect.ValueOf(v1["数学"]).Pointer() == reflect.ValueOf(v2["数学"]).Pointer(),
+	)
+
+	t.Delete("", []byte(`{"StudentId": 1001, "Subject": "数学", "Score": 98}`))
+	fmt.Println(t.Datas[0].Load(), t.Datas[1].Load())
+
+	// Output:
+	// <nil>
+	// <nil>
+	// map[数学:map[1001:95] 语文:map[1000:90]] [90 95]
+	// map[数学:map[1001:95] 语文:map[1000:90]] map[数学:map[1001:98] 语文:map[1000:90]] [90 98]
+	// true false
+	// map[数学:map[] 语文:map[1000:90]] [90]
+}
+
+func ExampleData_SnapshotDelay() {
+	var m map[int]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{{
+			RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}, Value: "Score",
+			Snapshot: true, SnapshotDelay: 20 * time.Millisecond,
+		}},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+	time.Sleep(50 * time.Millisecond)
+	fmt.Println(t.Datas[0].Load())
+
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "数学", "Score": 95}`))
+	t.Create("", []byte(`{"StudentId": 1002, "Subject": "数学", "Score": 96}`))
+	fmt.Println(t.Datas[0].Load())
+	time.Sleep(50 * time.Millisecond)
+	fmt.Println(t.Datas[0].Load())
+
+	// Output:
+	// <nil>
+	// map[1000:90]
+	// map[1000:90]
+	// map[1000:90 1001:95 1002:96]
+}
+
+func ExampleData_Snapshot_batch() {
+	var m map[int]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{{
+			RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}, Value: "Score", Snapshot: true,
+		}},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+	// as if the last copy was slow.
+	mutex.Lock()
+	t.Datas[0].snapshot.cost = 10 * time.Millisecond
+	t.Datas[0].snapshot.publishedAt = time.Now()
+	mutex.Unlock()
+
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "数学", "Score": 95}`))
+	t.Create("", []byte(`{"StudentId": 1002, "Subject": "数学", "Score": 96}`))
+	fmt.Println(t.Datas[0].Load())
+	time.Sleep(150 * time.Millisecond)
+	fmt.Println(t.Datas[0].Load())
+	// the last copy is fast, so the change is published immediately.
+	t.Create("", []byte(`{"StudentId": 1003, "Subject": "数学", "Score": 97}`))
+	fmt.Println(t.Datas[0].Load())
+
+	// Output:
+	// <nil>
+	// map[1000:90]
+	// map[1000:90 1001:95 1002:96]
+	// map[1000:90 1001:95 1002:96 1003:97]
+}
+
+func ExampleData_initSnapshot() {
+	var m map[int]int
+	var index OrderedIndex
+	var mutex sync.RWMutex
+	fmt.Println((&Table{Name: "scores", RowStruct: Score{}, Datas: []*Data{{
+		RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}, Value: "Score",
+		SnapshotDelay: time.Second,
+	}}}).init("db", testQuerier{}, testLogger))
+	fmt.Println((&Table{Name: "scores", RowStruct: Score{}, Lazy: &LazyOptions{}, Datas: []*Data{{
+		RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}, Value: "Score",
+		Snapshot: true,
+	}}}).init("db", testQuerier{}, testLogger))
+	fmt.Println((&Table{Name: "scores", RowStruct: Score{}, Datas: []*Data{{
+		RWMutex: &mutex, DataPtr: &index, IndexKeys: []string{"Score"},
+		IndexUniqueKey: []string{"StudentId"}, Snapshot: true,
+	}}}).init("db", testQuerier{}, testLogger))
+	// Output:
+	// Data.SnapshotDelay should be zero, if Data.Snapshot is false.
+	// Data.Snapshot is not supported for a lazy table.
+	// Data.Snapshot: Data.DataPtr should be a map or slice.
+}
+
+func newBenchmarkTable(b *testing.B, snapshot bool, rows int) (*Table, *map[int]int) {
+	var m map[int]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{{
+			RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}, Value: "Score",
+			Snapshot: snapshot,
+		}},
+	}
+	if err := t.init("db", testQuerier{}, testLogger); err != nil {
+		b.Fatal(err)
+	}
+	var scores = make([]Score, rows)
+	for i := range scores {
+		scores[i] = Score{StudentId: i, Score: i}
+	}
+	t.Save(scores)
+	return t, &m
+}
+
+// Reads under RLock while the table is changed.
+func BenchmarkData_readRLock(b *testing.B) {
+	t, m := newBenchmarkTable(b, false, 1000)
+	benchmarkRead(b, t, func() int {
+		t.Datas[0].RLock()
+		defer t.Datas[0].RUnlock()
+		return (*m)[500]
+	})
+}
+
+// Reads by Load while the table is changed.
+func BenchmarkData_readLoad(b *testing.B) {
+	t, _ := newBenchmarkTable(b, true, 1000)
+	benchmarkRead(b, t, func() int {
+		return t.Datas[0].Load().(map[int]int)[500]
+	})
+}
+
+func benchmarkRead(b *testing.B, t *Table, read func() int) {
+	var done = make(chan struct{})
+	go func() {
+		content := []byte(`{"StudentId": 1, "Score": 1}`)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				t.Update("", content, content)
+			}
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			read()
+		}
+	})
+	close(done)
+}
+
+// The cost of a change, the top level map is copied on each publish.
+func BenchmarkData_publish(b *testing.B) {
+	for _, rows := range []int{100, 10000} {
+		for _, snapshot := range []bool{false, true} {
+			b.Run(strconv.Itoa(rows)+"-"+strconv.FormatBool(snapshot), func(b *testing.B) {
+				t, _ := newBenchmarkTable(b, snapshot, rows)
+				content := []byte(`{"StudentId": 1, "Score": 1}`)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					t.Update("", content, content)
+				}
+			})
+		}
+	}
+}
@@ -8,23 +8,71 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-
-	"github.com/lovego/sorted_sets"
+	"time"
 )
 
 type Data struct {
+	// Datas of a table sharing the same RWMutex are updated in one critical section for each change.
+	// It's required unless DataPtr is a ShardedMap.
 	*sync.RWMutex
 	// DataPtr is a pointer to a map or slice to store data, required.
 	DataPtr interface{}
 	// MapKeys is the field names to get map keys from row struct, required if DataPtr is a map.
+	// If a field is a slice of the map key type, the row is saved under each element of the slice.
+	// A name can also be a method of row struct of "func () T" form, or a name in "MapKeyFuncs",
+	// or several field names separated by "," if the map key is a struct, then the key struct's
+	// fields of the same names are set.
 	MapKeys []string
-	// Value is the field name to get map or slice value from row struct.
-	// If it's empty, the whole row struct is used.
+	// MapKeyFuncs is optional. It's the functions to get map keys by the names in "MapKeys",
+	// each one should be of "func (RowStruct) T" or "func (*RowStruct) T" form.
+	MapKeyFuncs map[string]interface{}
+	// NullKeys is optional. If a name in "MapKeys" is a pointer or nullable type whose underlying
+	// type is assignable to the map key type, such as *int64 or sql.NullString, it's dereferenced or
+	// unwrapped as the map key. The rows whose such a key is NULL are skipped, unless a key for NULL
+	// is set by the name in NullKeys, then the rows are saved under it as a dedicated bucket.
+	NullKeys map[string]interface{}
+	// Value is the field name to get map or slice value from row struct, it can also be a method of
+	// row struct of "func () T" form. If it's empty, the whole row struct is used. If it's a pointer
+	// or nullable type whose underlying type is assignable to the value type, it's dereferenced or
+	// unwrapped, and the rows whose value is NULL are skipped.
 	Value string
+	// ValueFunc is optional. If it's not nil, it's used to get the value instead of "Value", and
+	// "Value" is only used as a name. It should be of "func (RowStruct) T" or "func (*RowStruct) T"
+	// form.
+	ValueFunc interface{}
 
 	// If the DataPtr or map value is a slice, it's used as sorted set. If it's a sorted set of struct,
 	// SortedSetUniqueKey is required, it specifies the fields used as unique key.
 	SortedSetUniqueKey []string
+	// SortBy is optional. If it's not empty, a sorted set of struct is ordered by these fields of
+	// the value struct instead of "SortedSetUniqueKey", such as "Score DESC" or "UpdatedAt". Values
+	// of the same SortBy fields are ordered by "SortedSetUniqueKey", which still identifies a value.
+	SortBy []string
+	// SortLess is optional. If it's not nil, a sorted set is ordered by it instead of "SortBy". It
+	// should be of "func (a, b T) bool" form, T is the element type of the sorted set.
+	SortLess interface{}
+	// SortedSetLimit is optional. If it's positive, each sorted set keeps only the first values of
+	// this number in its order, such as the latest 20 orders of each customer. If a set which has
+	// dropped values loses a value, it's refilled from the rows of "RowStore" if it's true, or by
+	// querying the rows of its map keys from database out of the lock.
+	SortedSetLimit int
+
+	// Aggregate is optional. If it's not empty, the map value is an aggregate of the rows under the
+	// map keys, instead of the rows. It's one of "count", "sum", "min", "max", and "Value" is the
+	// number field to aggregate(empty for "count"). The map value should be a number type.
+	Aggregate string
+	// AggregateUniqueKey is the fields to identify a row in an aggregate. If empty, and row struct
+	// has a "Id" Field, it's used as "AggregateUniqueKey".
+	AggregateUniqueKey []string
+
+	// IndexKeys is required if DataPtr is a pointer to OrderedIndex. The values are ordered by these
+	// fields, and then by "IndexUniqueKey".
+	IndexKeys []string
+	// IndexUniqueKey is the fields to identify a row in an OrderedIndex or SearchIndex. If empty,
+	// and row struct has a "Id" Field, it's used as "IndexUniqueKey".
+	IndexUniqueKey []string
+	// SearchFields is required if DataPtr is a pointer to SearchIndex. It's the string fields to search.
+	SearchFields []string
 
 	// Preprocess is optional. It's a method name of row struct. It should be of "func ()" form.
 	// It is called before Precond method is called.
@@ -32,6 +80,54 @@ type Data struct {
 	// Precond is optional. It's a method name of row struct. It should be of "func () bool" form.
 	// It is called before handling, if the return value is false, no handling(save or remove) is performed.
 	Precond string
+	// PrecondFields is the fields used by Precond. An update which doesn't change the fields used
+	// by the Data is skipped, or saved in place, but if Precond is not empty and PrecondFields is
+	// empty, or Preprocess is not empty, every update is handled by removing and saving.
+	PrecondFields []string
+
+	// Snapshot is optional. If it's true, an immutable copy of the map or slice is published after
+	// each change, and "Load" returns it without any lock. The top level map values which are not
+	// changed are shared between copies, but the top level map itself is copied on each publish, so
+	// it suits a Data which is read heavily and has a small top level map, or whose changes come in
+	// bursts with "SnapshotDelay". If "SnapshotDelay" is zero and a copy takes longer than 1ms, the
+	// changes in the next 9 times of the copy time are published together, so "Load" may lag behind
+	// that long. See the benchmarks in cow_test.go.
+	Snapshot bool
+	// SnapshotDelay is optional. If it's positive, changes are published at most once in this
+	// duration, so a burst of changes is copied only once, but "Load" may lag behind this duration.
+	SnapshotDelay time.Duration
+
+	// the table which the data belongs to.
+	table *Table
+	// not nil if the table is lazy.
+	lazy *lazyData
+	// not nil if Aggregate is not empty.
+	aggregate *aggregateData
+	// not nil if DataPtr is a pointer to OrderedIndex.
+	index *OrderedIndex
+	// not nil if DataPtr is a pointer to SearchIndex.
+	search *SearchIndex
+	// not nil if DataPtr is a pointer to ShardedMap.
+	sharded *ShardedMap
+	// not nil if SortBy or SortLess is not empty.
+	sortOrder *sortedSetOrder
+	// not nil if SortedSetLimit is positive.
+	limit *sortedSetLimit
+	// not nil if Snapshot is true.
+	snapshot *cowData
+	// get the map keys and the value from a row.
+	keyGetters  []*getter
+	valueGetter *getter
+	// the keys for NULL of each layer, not nil if NullKeys is not empty.
+	nullKeys []reflect.Value
+	// top level fields which decide where the value is saved, see "affected".
+	keyFields []int
+	// top level fields of the value, nil if the value is the whole row.
+	valueFields []int
+	// every update is handled by removing and saving.
+	alwaysUpdate bool
+	// not nil if any of MapKeys is a slice, it tells which of MapKeys is a slice.
+	fanOut []bool
 
 	// for cache manage
 	manageKey  string
@@ -50,27 +146,77 @@ type Data struct {
 }
 
 func (d *Data) save(row reflect.Value) {
+	defer d.lock(row)()
+	d.saveLocked(row)
+}
+
+// lock locks the Data for the rows, or the whole Data if no rows. It returns the unlock function.
+// Only the shards of the rows are locked if DataPtr is a ShardedMap.
+func (d *Data) lock(rows ...reflect.Value) func() {
+	if d.sharded != nil {
+		return d.sharded.lock(d, rows)
+	}
+	d.Lock()
+	return d.Unlock
+}
+
+// saveLocked should be called with the lock held.
+func (d *Data) saveLocked(row reflect.Value) {
 	d.preprocess(row)
 	if !d.precond(row) {
 		return
 	}
-	d.Lock()
-	defer d.Unlock()
+	if d.lazy != nil && !d.tracked(row) {
+		return
+	}
+	d.saveRow(row)
+	d.touch(row)
+}
 
-	if d.dataV.Kind() == reflect.Slice {
-		d.dataV.Set(sorted_sets.SaveValue(d.dataV, d.getValue(row), d.SortedSetUniqueKey...))
+// saveRow should be called with the lock held.
+func (d *Data) saveRow(row reflect.Value) {
+	if d.aggregate != nil {
+		d.saveAggregate(row)
+	} else if d.index != nil {
+		d.saveToIndex(row)
+	} else if d.search != nil {
+		d.saveToSearch(row)
+	} else if d.dataV.Kind() == reflect.Slice {
+		d.saveToSlice(row)
 	} else {
-		d.saveToMap(row)
+		for _, keys := range d.mapKeys(row) {
+			d.saveToMap(row, keys)
+		}
 	}
 }
 
-func (d *Data) saveToMap(row reflect.Value) {
-	mapV := d.dataV
+func (d *Data) saveToSlice(row reflect.Value) {
+	if value := d.getValue(row); value.IsValid() {
+		d.trackMember(nil, row, true)
+		d.dataV.Set(d.saveToSortedSet(nil, d.dataV, value))
+	}
+}
+
+func (d *Data) removeFromSlice(row reflect.Value) {
+	if value := d.getValue(row); value.IsValid() {
+		d.trackMember(nil, row, false)
+		d.dataV.Set(d.removeFromSortedSet(nil, d.dataV, value))
+	}
+}
+
+func (d *Data) saveToMap(row reflect.Value, keys []reflect.Value) {
+	value := d.getValue(row)
+	if !value.IsValid() {
+		// a NULL value.
+		return
+	}
+	d.trackMember(keys, row, true)
+	mapV := d.rootMap(keys[0])
 	if mapV.IsNil() {
 		mapV.Set(reflect.MakeMap(mapV.Type()))
 	}
-	for i := 0; i < len(d.MapKeys)-1; i++ {
-		key := row.FieldByName(d.MapKeys[i])
+	for i := 0; i < len(keys)-1; i++ {
+		key := keys[i]
 		value := mapV.MapIndex(key)
 		if !value.IsValid() {
 			value = reflect.MakeMap(mapV.Type().Elem())
@@ -81,45 +227,228 @@ func (d *Data) saveToMap(row reflect.Value) {
 		mapV = value
 	}
 
-	key := row.FieldByName(d.MapKeys[len(d.MapKeys)-1])
-	value := d.getValue(row)
+	key := keys[len(keys)-1]
 	if d.isSortedSets {
-		value = sorted_sets.SaveValue(mapV.MapIndex(key), value, d.SortedSetUniqueKey...)
+		value = d.saveToSortedSet(keys, mapV.MapIndex(key), value)
 	}
 	mapV.SetMapIndex(key, value)
 }
 
 func (d *Data) remove(row reflect.Value) {
+	unlock := d.lock(row)
+	d.removeLocked(row)
+	unlock()
+	d.refillByQuery()
+}
+
+// removeLocked should be called with the lock held.
+func (d *Data) removeLocked(row reflect.Value) {
 	d.preprocess(row)
 	if !d.precond(row) {
 		return
 	}
-	d.Lock()
-	defer d.Unlock()
+	if d.lazy != nil && !d.tracked(row) {
+		return
+	}
+	d.touch(row)
 
-	if d.dataV.Kind() == reflect.Slice {
-		d.dataV.Set(sorted_sets.RemoveValue(d.dataV, d.getValue(row), d.SortedSetUniqueKey...))
+	if d.aggregate != nil {
+		d.removeAggregate(row)
+	} else if d.index != nil {
+		d.removeFromIndex(row)
+	} else if d.search != nil {
+		d.removeFromSearch(row)
+	} else if d.dataV.Kind() == reflect.Slice {
+		d.removeFromSlice(row)
 	} else {
-		d.removeFromMap(row)
+		for _, keys := range d.mapKeys(row) {
+			d.removeFromMap(row, keys)
+		}
+	}
+	d.refill()
+}
+
+// updateLocked removes the old row and saves the new row. If the changed fields don't affect the
+// keys, the new row is saved in place, or skipped if the value is not changed either. If any of
+// MapKeys is a slice, only the map keys not in the new row are removed, the others are saved in
+// place. It should be called with the lock held.
+func (d *Data) updateLocked(oldRow, newRow reflect.Value, changed []bool) {
+	if keys, value := d.affected(changed); !keys {
+		if value {
+			d.saveLocked(newRow)
+		}
+		return
+	}
+	if d.fanOut == nil {
+		d.removeLocked(oldRow)
+		d.saveLocked(newRow)
+		return
+	}
+	d.preprocess(oldRow)
+	d.preprocess(newRow)
+	var oldKeys, newKeys [][]reflect.Value
+	if d.precond(oldRow) {
+		oldKeys = d.mapKeys(oldRow)
+	}
+	if d.precond(newRow) {
+		newKeys = d.mapKeys(newRow)
+	}
+	var saving = make(map[interface{}]bool, len(newKeys))
+	for _, keys := range newKeys {
+		saving[mapKeysArray(keys)] = true
+	}
+	if oldKeys != nil {
+		d.touch(oldRow)
+	}
+	if newKeys != nil {
+		d.touch(newRow)
+	}
+	for _, keys := range oldKeys {
+		if !saving[mapKeysArray(keys)] {
+			d.removeFromMap(oldRow, keys)
+		}
+	}
+	for _, keys := range newKeys {
+		d.saveToMap(newRow, keys)
+	}
+	d.refill()
+}
+
+// skipsNullKeys reports if any of MapKeys is nullable and has no key in NullKeys, so the rows whose
+// such a key is NULL are not saved.
+func (d *Data) skipsNullKeys() bool {
+	for i, g := range d.keyGetters {
+		if g.nullable && (d.nullKeys == nil || !d.nullKeys[i].IsValid()) {
+			return true
+		}
+	}
+	return false
+}
+
+// mapKeys returns the map keys of the row. If any of MapKeys is a slice, the row has a map key for
+// each distinct element of the slice. If any of MapKeys is NULL and has no key in NullKeys, the row
+// has no map keys.
+func (d *Data) mapKeys(row reflect.Value) [][]reflect.Value {
+	var result = [][]reflect.Value{make([]reflect.Value, 0, len(d.MapKeys))}
+	for i, g := range d.keyGetters {
+		field := g.get(row)
+		if !field.IsValid() {
+			if d.nullKeys == nil || !d.nullKeys[i].IsValid() {
+				return nil
+			}
+			field = d.nullKeys[i]
+		}
+		if d.fanOut == nil || !d.fanOut[i] {
+			for j := range result {
+				result[j] = append(result[j], field)
+			}
+			continue
+		}
+		var next [][]reflect.Value
+		var seen = make(map[interface{}]bool, field.Len())
+		for k := 0; k < field.Len(); k++ {
+			elem := field.Index(k)
+			if seen[elem.Interface()] {
+				continue
+			}
+			seen[elem.Interface()] = true
+			for _, keys := range result {
+				next = append(next, append(keys[:len(keys):len(keys)], elem))
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+// mapKeysArray returns a comparable array of the map keys.
+// convertKey converts v to the key type. Only a value assignable to the type, or of the same kind
+// family of the type, such as signed integers, is converted, so 65 is not converted to "A". A number
+// which overflows the type is not converted either.
+func convertKey(v reflect.Value, typ reflect.Type) (reflect.Value, bool) {
+	if !v.IsValid() {
+		return v, false
+	}
+	if v.Type().AssignableTo(typ) {
+		return v.Convert(typ), true
+	}
+	family := kindFamily(v.Kind())
+	if family == 0 || family != kindFamily(typ.Kind()) {
+		return reflect.Value{}, false
+	}
+	zero := reflect.Zero(typ)
+	switch family {
+	case 1:
+		if zero.OverflowInt(v.Int()) {
+			return reflect.Value{}, false
+		}
+	case 2:
+		if zero.OverflowUint(v.Uint()) {
+			return reflect.Value{}, false
+		}
+	case 3:
+		if zero.OverflowFloat(v.Float()) {
+			return reflect.Value{}, false
+		}
+	}
+	return v.Convert(typ), true
+}
+
+// kindFamily returns the family of the kind: 1 for signed integers, 2 for unsigned integers,
+// 3 for floats, 4 for string, 5 for bool, and 0 for others.
+func kindFamily(kind reflect.Kind) int {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return 1
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return 2
+	case reflect.Float32, reflect.Float64:
+		return 3
+	case reflect.String:
+		return 4
+	case reflect.Bool:
+		return 5
+	}
+	return 0
+}
+
+func mapKeysArray(keys []reflect.Value) interface{} {
+	array := reflect.New(reflect.ArrayOf(len(keys), interfaceType)).Elem()
+	for i := range keys {
+		array.Index(i).Set(keys[i])
+	}
+	return array.Interface()
+}
+
+// rootMap returns the top level map of the first key, it's a shard if DataPtr is a ShardedMap.
+func (d *Data) rootMap(key reflect.Value) reflect.Value {
+	if d.sharded != nil {
+		return d.sharded.shard(key).m
 	}
+	return d.dataV
 }
 
-func (d *Data) removeFromMap(row reflect.Value) {
-	mapV := d.dataV
-	for i := 0; i < len(d.MapKeys)-1; i++ {
-		key := row.FieldByName(d.MapKeys[i])
-		mapV = mapV.MapIndex(key)
+func (d *Data) removeFromMap(row reflect.Value, keys []reflect.Value) {
+	value := d.getValue(row)
+	if !value.IsValid() {
+		// a NULL value, it's not saved.
+		return
+	}
+	d.trackMember(keys, row, false)
+	mapV := d.rootMap(keys[0])
+	for i := 0; i < len(keys)-1; i++ {
+		mapV = mapV.MapIndex(keys[i])
 		if !mapV.IsValid() || mapV.IsNil() {
 			return
 		}
 	}
-	key := row.FieldByName(d.MapKeys[len(d.MapKeys)-1])
+	key := keys[len(keys)-1]
 	if d.isSortedSets {
 		slice := mapV.MapIndex(key)
 		if !slice.IsValid() {
 			return
 		}
-		slice = sorted_sets.RemoveValue(slice, d.getValue(row), d.SortedSetUniqueKey...)
+		slice = d.removeFromSortedSet(keys, slice, value)
 		if !slice.IsValid() || slice.Len() == 0 {
 			mapV.SetMapIndex(key, reflect.Value{})
 		} else {
@@ -131,9 +460,32 @@ func (d *Data) removeFromMap(row reflect.Value) {
 }
 
 func (d *Data) clear() {
-	d.Lock()
-	defer d.Unlock()
-	if d.dataV.Kind() == reflect.Slice {
+	defer d.lock()()
+	d.clearLocked()
+}
+
+// clearLocked should be called with the lock held.
+func (d *Data) clearLocked() {
+	d.touchAll()
+	if d.lazy != nil {
+		d.lazy.clear()
+	}
+	if d.aggregate != nil {
+		d.aggregate.groups = make(map[interface{}]*aggregateGroup)
+	}
+	if d.limit != nil {
+		d.limit.clear()
+	}
+	if d.sortOrder != nil {
+		d.sortOrder.clear()
+	}
+	if d.index != nil {
+		d.index.clear()
+	} else if d.search != nil {
+		d.search.clear()
+	} else if d.sharded != nil {
+		d.sharded.clear()
+	} else if d.dataV.Kind() == reflect.Slice {
 		d.dataV.Set(reflect.MakeSlice(d.dataV.Type(), 0, d.dataV.Cap()))
 	} else {
 		d.dataV.Set(reflect.MakeMap(d.dataV.Type()))
@@ -142,10 +494,19 @@ func (d *Data) clear() {
 
 func (d *Data) getValue(row reflect.Value) reflect.Value {
 	value := row
-	if d.Value != "" {
-		value = row.FieldByName(d.Value)
+	if d.valueGetter != nil {
+		if value = d.valueGetter.get(row); !value.IsValid() {
+			// a NULL value.
+			return value
+		}
 	}
 	if d.realValueIsPointer {
+		if !value.CanAddr() {
+			// a computed value.
+			ptr := reflect.New(value.Type())
+			ptr.Elem().Set(value)
+			return ptr
+		}
 		value = value.Addr()
 	}
 	return value
@@ -168,7 +529,25 @@ func (d *Data) precond(row reflect.Value) bool {
 
 func (d *Data) Key() string {
 	if d.manageKey == `` {
-		d.manageKey = addKeyValueNames(d.dataV.Type().String(), d.MapKeys, d.Value)
+		valueName := d.Value
+		if d.ValueFunc != nil && valueName == "" {
+			valueName = "ValueFunc"
+		}
+		if d.Aggregate != "" {
+			valueName = d.Aggregate + "(" + d.Value + ")"
+		}
+		if d.index != nil || d.search != nil {
+			fields := d.IndexKeys
+			if d.search != nil {
+				fields = d.SearchFields
+			}
+			d.manageKey = fmt.Sprintf("%v[%s]%s", d.dataV.Type(), strings.Join(fields, ","), valueName)
+		} else if d.sharded != nil {
+			d.manageKey = fmt.Sprintf("%v[%s]", shardedMapType,
+				addKeyValueNames(d.dataV.Type().String(), d.MapKeys, valueName))
+		} else {
+			d.manageKey = addKeyValueNames(d.dataV.Type().String(), d.MapKeys, valueName)
+		}
 		if d.Precond != "" {
 			d.manageKey += fmt.Sprintf("(%s)", d.Precond)
 		}
@@ -177,6 +556,15 @@ func (d *Data) Key() string {
 }
 
 func (d *Data) Size() int {
+	if d.index != nil {
+		return d.index.Len()
+	}
+	if d.search != nil {
+		return d.search.Len()
+	}
+	if d.sharded != nil {
+		return d.sharded.Len()
+	}
 	return d.dataV.Len()
 }
 
@@ -185,6 +573,13 @@ func (d *Data) Data(keys ...string) (interface{}, error) {
 		return d.DataPtr, nil
 	}
 	var data = d.dataV
+	if d.sharded != nil {
+		key, err := convertStrToType(keys[0], data.Type().Key())
+		if err != nil {
+			return nil, err
+		}
+		data = d.sharded.shard(key).m
+	}
 	for _, str := range keys {
 		switch data.Kind() {
 		case reflect.Map:
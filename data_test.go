@@ -232,3 +232,49 @@ func ExampleAddKeyValueNames() {
 	// map[Type:string]map[Id:int64]*uint16
 	// map[Type:string]map[Id:int64]Flags:*uint16
 }
+
+type Product struct {
+	Id   int
+	Name string
+	Tags []string
+}
+
+func ExampleData_fanOut() {
+	var byTag map[string]map[int]string
+	var sets map[string][]Product
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "products", RowStruct: Product{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &byTag, MapKeys: []string{"Tags", "Id"}, Value: "Name"},
+			{RWMutex: &mutex, DataPtr: &sets, MapKeys: []string{"Tags"}, SortedSetUniqueKey: []string{"Id"}},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Clear()
+
+	t.Create("", []byte(`{"Id": 1, "Name": "apple", "Tags": ["fruit", "red", "fruit"]}`))
+	t.Create("", []byte(`{"Id": 2, "Name": "cherry", "Tags": ["fruit", "red"]}`))
+	t.Create("", []byte(`{"Id": 3, "Name": "stone", "Tags": null}`))
+	fmt.Println(byTag)
+	fmt.Println(sets)
+
+	t.Update("",
+		[]byte(`{"Id": 1, "Name": "apple", "Tags": ["fruit", "red", "fruit"]}`),
+		[]byte(`{"Id": 1, "Name": "green apple", "Tags": ["fruit", "green"]}`),
+	)
+	fmt.Println(byTag)
+	fmt.Println(sets)
+
+	t.Delete("", []byte(`{"Id": 2, "Name": "cherry", "Tags": ["fruit", "red"]}`))
+	fmt.Println(byTag)
+	fmt.Println(sets)
+	// Output:
+	// <nil>
+	// map[fruit:map[1:apple 2:cherry] red:map[1:apple 2:cherry]]
+	// map[fruit:[{1 apple [fruit red fruit]} {2 cherry [fruit red]}] red:[{1 apple [fruit red fruit]} {2 cherry [fruit red]}]]
+	// map[fruit:map[1:green apple 2:cherry] green:map[1:green apple] red:map[2:cherry]]
+	// map[fruit:[{1 green apple [fruit green]} {2 cherry [fruit red]}] green:[{1 green apple [fruit green]}] red:[{2 cherry [fruit red]}]]
+	// map[fruit:map[1:green apple] green:map[1:green apple] red:map[]]
+	// map[fruit:[{1 green apple [fruit green]}] green:[{1 green apple [fruit green]}]]
+}
@@ -7,17 +7,53 @@ import (
 )
 
 func (d *Data) init(rowStruct reflect.Type) error {
-	if d.RWMutex == nil {
+	d.dataV = reflect.ValueOf(d.DataPtr)
+	if d.RWMutex == nil && (!d.dataV.IsValid() || d.dataV.Type() != reflect.PtrTo(shardedMapType)) {
 		return errors.New("Data.RWMutex is nil.")
 	}
-
-	d.dataV = reflect.ValueOf(d.DataPtr)
 	typ := d.dataV.Type()
-	if typ.Kind() != reflect.Ptr || d.dataV.IsNil() ||
-		(typ.Elem().Kind() != reflect.Map && typ.Elem().Kind() != reflect.Slice) {
-		return errors.New("Data.DataPtr should be a non nil pointer to a map or slice.")
+	if typ.Kind() != reflect.Ptr || d.dataV.IsNil() || (typ.Elem().Kind() != reflect.Map &&
+		typ.Elem().Kind() != reflect.Slice && typ.Elem() != orderedIndexType &&
+		typ.Elem() != searchIndexType && typ.Elem() != shardedMapType) {
+		return errors.New("Data.DataPtr should be a non nil pointer to a map, slice, " +
+			"OrderedIndex, SearchIndex or ShardedMap.")
 	}
 	d.dataV = d.dataV.Elem()
+	if d.dataV.Type() == shardedMapType {
+		if err := d.checkShardedMap(); err != nil {
+			return err
+		}
+	}
+
+	if d.dataV.Type() == orderedIndexType || d.dataV.Type() == searchIndexType {
+		check := d.checkIndex
+		if d.dataV.Type() == searchIndexType {
+			check = d.checkSearch
+		}
+		if err := check(rowStruct); err != nil {
+			return err
+		}
+		if err := d.checkPreprocess(rowStruct); err != nil {
+			return err
+		}
+		return d.checkPrecond(rowStruct)
+	}
+	if len(d.IndexKeys) > 0 {
+		return errors.New("Data.IndexKeys should be empty, if Data.DataPtr is not a OrderedIndex.")
+	}
+	if len(d.SearchFields) > 0 {
+		return errors.New("Data.SearchFields should be empty, if Data.DataPtr is not a SearchIndex.")
+	}
+
+	if d.Aggregate != "" {
+		if err := d.checkAggregate(rowStruct); err != nil {
+			return err
+		}
+		if err := d.checkPreprocess(rowStruct); err != nil {
+			return err
+		}
+		return d.checkPrecond(rowStruct)
+	}
 
 	innerType, err := d.checkMapKeys(rowStruct)
 	if err != nil {
@@ -34,6 +70,12 @@ func (d *Data) init(rowStruct reflect.Type) error {
 	if err := d.checkSortedSetUniqueKey(valueType); err != nil {
 		return err
 	}
+	if err := d.checkSortBy(valueType, innerType); err != nil {
+		return err
+	}
+	if err := d.checkSortedSetLimit(); err != nil {
+		return err
+	}
 	if err := d.checkPreprocess(rowStruct); err != nil {
 		return err
 	}
@@ -41,6 +83,17 @@ func (d *Data) init(rowStruct reflect.Type) error {
 }
 
 func (d *Data) checkMapKeys(rowStruct reflect.Type) (reflect.Type, error) {
+	for name := range d.MapKeyFuncs {
+		if notIn(name, d.MapKeys) {
+			return nil, fmt.Errorf("Data.MapKeyFuncs: %s, is not in Data.MapKeys.", name)
+		}
+	}
+	for name := range d.NullKeys {
+		if notIn(name, d.MapKeys) {
+			return nil, fmt.Errorf("Data.NullKeys: %s, is not in Data.MapKeys.", name)
+		}
+	}
+	d.keyGetters, d.nullKeys = make([]*getter, len(d.MapKeys)), nil
 	typ := d.dataV.Type()
 	if typ.Kind() == reflect.Slice {
 		if len(d.MapKeys) > 0 {
@@ -71,30 +124,66 @@ func (d *Data) checkMapKey(i int, rowStruct, keyType reflect.Type) error {
 		return nil
 	}
 	name := d.MapKeys[i]
-	field, ok := rowStruct.FieldByName(name)
-	if !ok {
-		return fmt.Errorf("Data.MapKeys[%d]: %s, no such field in row struct.", i, name)
+	g, err := newGetter(rowStruct, name, d.MapKeyFuncs[name], keyType)
+	if err != nil {
+		return fmt.Errorf("Data.MapKeys[%d]: %s, %v", i, name, err)
+	}
+	d.keyGetters[i] = g
+	if g.typ.Kind() == reflect.Slice && !g.typ.AssignableTo(keyType) &&
+		g.typ.Elem().AssignableTo(keyType) {
+		if d.fanOut == nil {
+			d.fanOut = make([]bool, len(d.MapKeys))
+		}
+		d.fanOut[i] = true
+		return nil
 	}
-	if !field.Type.AssignableTo(keyType) {
+	if !g.typ.AssignableTo(keyType) {
+		if g := nullableGetter(g, keyType); g != nil {
+			d.keyGetters[i] = g
+			return d.checkNullKey(i, keyType)
+		}
 		return fmt.Errorf(
-			"Data.MapKeys[%d]: %s, type %v is not assignable to %v.", i, name, field.Type, keyType,
+			"Data.MapKeys[%d]: %s, type %v is not assignable to %v.", i, name, g.typ, keyType,
 		)
 	}
+	if _, ok := d.NullKeys[name]; ok {
+		return fmt.Errorf("Data.NullKeys: %s, is not a pointer or nullable key.", name)
+	}
+	return nil
+}
+
+// checkNullKey checks the key for NULL of the nullable key of layer i.
+func (d *Data) checkNullKey(i int, keyType reflect.Type) error {
+	name := d.MapKeys[i]
+	key, ok := d.NullKeys[name]
+	if !ok {
+		return nil
+	}
+	v, ok := convertKey(reflect.ValueOf(key), keyType)
+	if !ok {
+		return fmt.Errorf("Data.NullKeys: %s, %v is not convertible to %v.", name, key, keyType)
+	}
+	if d.nullKeys == nil {
+		d.nullKeys = make([]reflect.Value, len(d.MapKeys))
+	}
+	d.nullKeys[i] = v
 	return nil
 }
 
 func (d *Data) checkValue(rowStruct, realValueType reflect.Type) (reflect.Type, error) {
-	valueType := rowStruct
-	if d.Value != "" {
-		if field, ok := rowStruct.FieldByName(d.Value); ok {
-			valueType = field.Type
-		} else {
-			return nil, fmt.Errorf("Data.Value: %s, no such field in row struct.", d.Value)
-		}
+	valueType, err := d.initValueGetter(rowStruct)
+	if err != nil {
+		return nil, err
 	}
 	if !valueType.AssignableTo(realValueType) {
+		var nullable *getter
+		if d.valueGetter != nil {
+			nullable = nullableGetter(d.valueGetter, realValueType)
+		}
 		if realValueType.Kind() == reflect.Ptr && valueType.AssignableTo(realValueType.Elem()) {
 			d.realValueIsPointer = true
+		} else if nullable != nil {
+			d.valueGetter, valueType = nullable, nullable.typ
 		} else {
 			return nil, fmt.Errorf(
 				"Data.Value: %s, type %v is not assignable to %v.", d.Value, valueType, realValueType,
@@ -19,7 +19,7 @@ func ExampleData_init_invalidDataPtr_1() {
 	d := Data{RWMutex: &mutex, DataPtr: map[int]int{}}
 	fmt.Println(d.init(nil))
 	// Output:
-	// Data.DataPtr should be a non nil pointer to a map or slice.
+	// Data.DataPtr should be a non nil pointer to a map, slice, OrderedIndex, SearchIndex or ShardedMap.
 }
 
 func ExampleData_init_invalidDataPtr_2() {
@@ -28,7 +28,7 @@ func ExampleData_init_invalidDataPtr_2() {
 	d := Data{RWMutex: &mutex, DataPtr: p}
 	fmt.Println(d.init(nil))
 	// Output:
-	// Data.DataPtr should be a non nil pointer to a map or slice.
+	// Data.DataPtr should be a non nil pointer to a map, slice, OrderedIndex, SearchIndex or ShardedMap.
 }
 
 func ExampleData_init_invalidMapKeys_1() {
@@ -55,7 +55,7 @@ func ExampleData_init_invalidMapKeys_3() {
 	d := Data{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"Student", "Subject"}}
 	fmt.Println(d.init(reflect.TypeOf(Score{})))
 	// Output:
-	// Data.MapKeys[0]: Student, no such field in row struct.
+	// Data.MapKeys[0]: Student, no such field or method in row struct.
 }
 
 func ExampleData_init_invalidMapKeys_4() {
@@ -85,7 +85,7 @@ func ExampleData_init_invalidValue_1() {
 	}
 	fmt.Println(d.init(reflect.TypeOf(Score{})))
 	// Output:
-	// Data.Value: theScore, no such field in row struct.
+	// Data.Value: theScore, no such field or method in row struct.
 }
 
 func ExampleData_init_invalidValue_2() {
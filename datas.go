@@ -0,0 +1,91 @@
+package pgcache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// AddData adds a Data to the table after the table is added to DB. The Data is backfilled from
+// "RowStore", or another Data which holds every row, or by one query of "LoadSql". Events are
+// blocked until the Data is added, so no change is missed. The Data is listed by manage through
+// the table's "GetDatas".
+func (t *Table) AddData(d *Data) error {
+	if t.rowStruct == nil {
+		return errors.New("Table.AddData: the table is not added to DB.")
+	}
+	if err := t.initData(d); err != nil {
+		return err
+	}
+
+	t.datasMutex.Lock()
+	defer t.datasMutex.Unlock()
+	for _, data := range t.Datas {
+		if data == d || data.DataPtr == d.DataPtr {
+			return fmt.Errorf("Table.AddData: Data %s already exists.", d.Key())
+		}
+	}
+	var rows []reflect.Value
+	// a lazy Data is loaded on demand.
+	if t.Lazy == nil {
+		var err error
+		if rows, err = t.backfillRows(); err != nil {
+			return fmt.Errorf("Table.AddData: %v", err)
+		}
+	}
+	unlock := d.lock()
+	d.clearLocked()
+	for _, row := range rows {
+		d.saveLocked(row)
+	}
+	d.publish()
+	unlock()
+	t.Datas = append(t.Datas[:len(t.Datas):len(t.Datas)], d)
+	t.groups = groupDatas(t.Datas)
+	return nil
+}
+
+// RemoveData removes the Data added to the table.
+func (t *Table) RemoveData(d *Data) error {
+	t.datasMutex.Lock()
+	defer t.datasMutex.Unlock()
+	for i, data := range t.Datas {
+		if data != d {
+			continue
+		}
+		if t.Verify != nil && t.Verify.data == d {
+			return fmt.Errorf("Table.RemoveData: Data %s is used by Verify.", d.Key())
+		}
+		if len(t.Datas) == 1 {
+			return errors.New("Table.RemoveData: the last Data can't be removed.")
+		}
+		datas := make([]*Data, 0, len(t.Datas)-1)
+		t.Datas = append(append(datas, t.Datas[:i]...), t.Datas[i+1:]...)
+		t.groups = groupDatas(t.Datas)
+		return nil
+	}
+	return fmt.Errorf("Table.RemoveData: no such Data %s.", d.Key())
+}
+
+// backfillRows returns the cached rows to backfill a Data, it should be called with the datasMutex
+// held.
+func (t *Table) backfillRows() ([]reflect.Value, error) {
+	if t.rowStore != nil {
+		return t.rowStore.all(), nil
+	}
+	var rows []reflect.Value
+	if data := t.rowsData(); data != nil {
+		data.eachRow(func(row reflect.Value) { rows = append(rows, row) })
+		return rows, nil
+	}
+	loaded, err := t.loadRows()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < loaded.Len(); i++ {
+		if row := loaded.Index(i); t.prepareRow(row, true) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
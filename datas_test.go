@@ -0,0 +1,101 @@
+package pgcache
+
+import (
+	"fmt"
+	"sync"
+)
+
+func ExampleTable_AddData() {
+	var m1 map[int]map[string]Score
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m1, MapKeys: []string{"StudentId", "Subject"}},
+		},
+	}
+	fmt.Println(t.AddData(&Data{}))
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+
+	var m2 = map[string]map[int]int{"数学": {1: 1}}
+	d2 := &Data{RWMutex: &mutex, DataPtr: &m2, MapKeys: []string{"Subject", "StudentId"}, Value: "Score"}
+	fmt.Println(t.AddData(d2))
+	fmt.Println(m2)
+	fmt.Println(t.AddData(&Data{
+		RWMutex: &mutex, DataPtr: &m2, MapKeys: []string{"Subject", "StudentId"}, Value: "Score",
+	}))
+	fmt.Println(t.AddData(&Data{RWMutex: &mutex, DataPtr: &m2}))
+
+	t.Update("",
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`),
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 97}`),
+	)
+	fmt.Println(m1, m2, len(t.GetDatas()))
+
+	fmt.Println(t.RemoveData(d2))
+	t.Delete("", []byte(`{"StudentId": 1000, "Subject": "语文", "Score": 90}`))
+	fmt.Println(m1, m2, len(t.GetDatas()))
+	fmt.Println(t.RemoveData(d2))
+	fmt.Println(t.RemoveData(t.Datas[0]))
+
+	// backfill by a query.
+	var m3 map[int]int
+	t2 := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m3, MapKeys: []string{"StudentId"}, Value: "Score"},
+		},
+	}
+	fmt.Println(t2.init("db", testQuerier{}, testLogger))
+	var m4 map[string]int
+	fmt.Println(t2.AddData(&Data{
+		RWMutex: &mutex, DataPtr: &m4, MapKeys: []string{"Subject"}, Value: "Score",
+	}))
+	fmt.Println(m3, m4)
+
+	// Output:
+	// Table.AddData: the table is not added to DB.
+	// <nil>
+	// <nil>
+	// map[语文:map[1000:90 1001:95]]
+	// Table.AddData: Data map[Subject:string]map[StudentId:int]Score:int already exists.
+	// Data.DataPtr is a 2 layers map, but Data.MapKeys has 0 field.
+	// map[1000:map[语文:{1000 语文 90}] 1001:map[语文:{1001 语文 97}]] map[语文:map[1000:90 1001:97]] 2
+	// <nil>
+	// map[1000:map[] 1001:map[语文:{1001 语文 97}]] map[语文:map[1000:90 1001:97]] 1
+	// Table.RemoveData: no such Data map[Subject:string]map[StudentId:int]Score:int.
+	// Table.RemoveData: the last Data can't be removed.
+	// <nil>
+	// <nil>
+	// map[] map[语文:90]
+}
+
+func ExampleTable_RemoveData() {
+	var m1 map[int]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m1, MapKeys: []string{"StudentId"}, Value: "Score"},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+
+	// the Datas of the same key are told apart by DataPtr.
+	var m2, m3 map[int]int
+	d2 := &Data{RWMutex: &mutex, DataPtr: &m2, MapKeys: []string{"StudentId"}, Value: "Score"}
+	d3 := &Data{RWMutex: &mutex, DataPtr: &m3, MapKeys: []string{"StudentId"}, Value: "Score"}
+	fmt.Println(t.AddData(d2), t.AddData(d3), d2.Key() == d3.Key())
+	fmt.Println(t.RemoveData(d2))
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+	fmt.Println(m1, m2, m3)
+
+	// Output:
+	// <nil>
+	// <nil> <nil> true
+	// <nil>
+	// map[1000:90 1001:95] map[1000:90] map[1000:90 1001:95]
+}
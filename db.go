@@ -1,9 +1,12 @@
 package pgcache
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"net/url"
 	"strings"
+	"sync"
 
 	"github.com/lovego/pgcache/manage"
 	"github.com/lovego/pgcache/pglistener"
@@ -14,6 +17,13 @@ type DB struct {
 	listener  *pglistener.Listener
 	dbQuerier DBQuerier
 	logger    Logger
+
+	mutex  sync.Mutex
+	tables map[string]*Table
+	// closed when all the tables are ready.
+	ready chan struct{}
+	// count of tables not ready.
+	unready int
 }
 
 type DBQuerier interface {
@@ -37,28 +47,144 @@ func New(dbAddr string, dbQuerier DBQuerier, logger Logger) (*DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &DB{name: dbName, listener: listener, dbQuerier: dbQuerier, logger: logger}, nil
+	ready := make(chan struct{})
+	close(ready)
+	return &DB{
+		name: dbName, listener: listener, dbQuerier: dbQuerier, logger: logger,
+		tables: make(map[string]*Table), ready: ready,
+	}, nil
+}
+
+// SetLoadParallelism set the max number of tables to load concurrently, the default is 4.
+// It should be called before any Add.
+func (db *DB) SetLoadParallelism(n int) {
+	db.listener.SetInitParallelism(n)
 }
 
+// Add a table to cache, it returns after the table's data is loaded. If the loading fails, the
+// error is logged, and the table is not ready until it's reloaded successfully, such as after the
+// db connection is lost and regained.
 func (db *DB) Add(table *Table) (*Table, error) {
+	inited, err := db.add(table)
+	if err != nil {
+		return nil, err
+	}
+	<-inited
+	return table, nil
+}
+
+// AddAsync add a table to cache, but doesn't wait for the table's data to be loaded.
+// Use "Table.Ready" or "DB.Ready" to know when the data is loaded.
+func (db *DB) AddAsync(table *Table) (*Table, error) {
+	if _, err := db.add(table); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// AddAll add tables to cache, the tables are loaded concurrently.
+// It returns after all the tables' data is loaded. If any table fails to be added, the tables
+// added before it are removed, so none of the tables is added.
+func (db *DB) AddAll(tables ...*Table) error {
+	var inits []<-chan struct{}
+	for i, table := range tables {
+		inited, err := db.add(table)
+		if err != nil {
+			for _, added := range tables[:i] {
+				if err := db.Remove(added.Name); err != nil {
+					db.logger.Error(fmt.Sprintf("AddAll: remove %s: %v", added.Name, err))
+				}
+			}
+			return fmt.Errorf("%s: %v", table.Name, err)
+		}
+		inits = append(inits, inited)
+	}
+	for _, inited := range inits {
+		<-inited
+	}
+	return nil
+}
+
+func (db *DB) add(table *Table) (<-chan struct{}, error) {
 	if err := table.init(db.name, db.dbQuerier, db.logger); err != nil {
 		return nil, err
 	}
-	if err := db.listener.Listen(table.Name, table.Columns, table.BigColumns, table); err != nil {
+	inited, err := db.listener.ListenAsync(table.Name, table.Columns, table.BigColumns, table)
+	if err != nil {
 		return nil, err
 	}
 	if err := manage.Register(db.name, table.Name, table); err != nil {
+		if err := db.listener.Unlisten(table.Name); err != nil {
+			db.logger.Error(fmt.Sprintf("unlisten %s: %v", table.Name, err))
+		}
 		return nil, err
 	}
-	return table, nil
+	db.watchReady(table)
+	if table.Verify != nil {
+		table.startVerify()
+	}
+	return inited, nil
+}
+
+func (db *DB) watchReady(table *Table) {
+	db.mutex.Lock()
+	db.tables[table.Name] = table
+	if db.unready == 0 {
+		db.ready = make(chan struct{})
+	}
+	db.unready++
+	db.mutex.Unlock()
+
+	go func() {
+		select {
+		case <-table.Ready():
+		case <-table.removed:
+		}
+		db.mutex.Lock()
+		defer db.mutex.Unlock()
+		if db.unready--; db.unready == 0 {
+			close(db.ready)
+		}
+	}()
+}
+
+// Ready returns a channel which is closed when all the tables added are ready. A table whose
+// loading fails is not ready until it's reloaded successfully, see "Table.Ready".
+func (db *DB) Ready() <-chan struct{} {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.ready
+}
+
+// WaitReady waits until all the tables added are ready or the context is done. Use a context with
+// a timeout, because a table whose loading fails is not ready until it's reloaded successfully.
+func (db *DB) WaitReady(ctx context.Context) error {
+	select {
+	case <-db.Ready():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (db *DB) Remove(table string) error {
 	manage.Unregister(db.name, table)
+	db.mutex.Lock()
+	if t := db.tables[table]; t != nil {
+		t.markRemoved()
+		delete(db.tables, table)
+	}
+	db.mutex.Unlock()
 	return db.listener.Unlisten(table)
 }
 
 func (db *DB) RemoveAll() error {
 	manage.UnregisterDB(db.name)
+	db.mutex.Lock()
+	for name, t := range db.tables {
+		t.markRemoved()
+		delete(db.tables, name)
+	}
+	db.mutex.Unlock()
 	return db.listener.UnlistenAll()
 }
@@ -1,6 +1,7 @@
 package pgcache_test
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
@@ -212,6 +213,94 @@ func Example2() {
 	// [{1 李雷 初三2班 2003-10-01 09:10:40 +0800} {2 韩梅梅 初三2班 2003-10-01 09:10:40 +0800}]
 }
 
+func ExampleDB_AddAll() {
+	initStudentsTable()
+
+	var studentsMap = make(map[int64]Student)
+	var classesMap = make(map[string][]Student)
+	var mutex sync.RWMutex
+
+	dbCache, err := pgcache.New(dbUrl, bsql.New(testDB, time.Second), logger)
+	if err != nil {
+		panic(err)
+	}
+	dbCache.SetLoadParallelism(2)
+	if err := dbCache.AddAll(&pgcache.Table{
+		Name:      "students",
+		RowStruct: Student{},
+		Datas: []*pgcache.Data{
+			{RWMutex: &mutex, DataPtr: &studentsMap, MapKeys: []string{"Id"}},
+		},
+	}, &pgcache.Table{
+		Name:      "public.students",
+		RowStruct: Student{},
+		Datas: []*pgcache.Data{
+			{
+				RWMutex: &mutex, DataPtr: &classesMap, MapKeys: []string{"Class"},
+				SortedSetUniqueKey: []string{"Id"},
+			},
+		},
+	}); err != nil {
+		fmt.Println(err)
+	}
+
+	// "students" is removed, so it can be added again.
+	var students = make(map[int64]Student)
+	fmt.Println(dbCache.AddAll(&pgcache.Table{
+		Name:      "students",
+		RowStruct: Student{},
+		Datas: []*pgcache.Data{
+			{RWMutex: &mutex, DataPtr: &students, MapKeys: []string{"Id"}},
+		},
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	fmt.Println(dbCache.WaitReady(ctx))
+	mutex.RLock()
+	fmt.Println(len(students))
+	mutex.RUnlock()
+
+	dbCache.RemoveAll()
+
+	// Output:
+	// public.students: pglistener: table 'public.students' is aready listened.
+	// <nil>
+	// <nil>
+	// 2
+}
+
+func ExampleDB_AddAsync() {
+	initStudentsTable()
+
+	var studentsMap = make(map[int64]Student)
+	var mutex sync.RWMutex
+
+	dbCache, err := pgcache.New(dbUrl, bsql.New(testDB, time.Second), logger)
+	if err != nil {
+		panic(err)
+	}
+	table, err := dbCache.AddAsync(&pgcache.Table{
+		Name:      "students",
+		RowStruct: Student{},
+		Datas: []*pgcache.Data{
+			{RWMutex: &mutex, DataPtr: &studentsMap, MapKeys: []string{"Id"}},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	<-table.Ready()
+	<-dbCache.Ready()
+	mutex.RLock()
+	fmt.Println(len(studentsMap))
+	mutex.RUnlock()
+
+	dbCache.RemoveAll()
+
+	// Output:
+	// 2
+}
+
 func connectDB(dbUrl string) *sql.DB {
 	db, err := sql.Open(`postgres`, dbUrl)
 	if err != nil {
@@ -0,0 +1,285 @@
+package pgcache
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// Decoder decodes a column value of a notification payload into a field. raw is the JSON of the
+// value made by "to_jsonb", it's never null, a NULL value sets the field to its zero value.
+type Decoder func(field reflect.Value, raw []byte) error
+
+var decoders = struct {
+	sync.RWMutex
+	byType   map[reflect.Type]Decoder
+	byPGType map[string]Decoder
+}{byType: make(map[reflect.Type]Decoder), byPGType: make(map[string]Decoder)}
+
+// the default decoders by type.
+var defaultDecoders sync.Map
+
+// RegisterDecoder registers a Decoder for the fields of a Go type. It should be called before the
+// tables are added to DB.
+//
+// Without a registered Decoder, a type implementing sql.Scanner is scanned from the JSON string
+// unquoted, or the JSON number, object or array as bytes, or the JSON bool, like the load by
+// "LoadSql". A time.Time or sql.NullTime is parsed from the timestamp, a []byte is decoded from the
+// hex of bytea, and other types are decoded by encoding/json.
+func RegisterDecoder(typ reflect.Type, decoder Decoder) {
+	decoders.Lock()
+	defer decoders.Unlock()
+	decoders.byType[typ] = decoder
+}
+
+// RegisterPGDecoder registers a Decoder for the columns of a PostgreSQL type, it's the type name in
+// pg_type, such as "hstore" or "int4range". It takes precedence over the Decoder of the Go type.
+// It should be called before the tables are added to DB, then the types of the columns are queried
+// when a table is inited.
+func RegisterPGDecoder(pgType string, decoder Decoder) {
+	decoders.Lock()
+	defer decoders.Unlock()
+	decoders.byPGType[pgType] = decoder
+}
+
+const pgTypesSql = `SELECT a.attname AS name, t.typname AS type
+FROM pg_attribute a JOIN pg_type t ON t.oid = a.atttypid
+WHERE a.attrelid = %s::regclass AND a.attnum > 0 AND NOT a.attisdropped`
+
+type pgColumnType struct {
+	Name string
+	Type string
+}
+
+// initPGTypes queries the types of the columns, if any PG Decoder is registered.
+func (t *Table) initPGTypes(dbQuerier DBQuerier) error {
+	decoders.RLock()
+	registered := len(decoders.byPGType) > 0
+	decoders.RUnlock()
+	if !registered {
+		return nil
+	}
+	pgTypes, err := t.queryPGTypes(dbQuerier)
+	if err != nil {
+		return err
+	}
+	t.pgTypes = pgTypes
+	return nil
+}
+
+// queryPGTypes queries the types of the columns of the table.
+func (t *Table) queryPGTypes(dbQuerier DBQuerier) (map[string]string, error) {
+	var columns []pgColumnType
+	if err := dbQuerier.Query(&columns, fmt.Sprintf(pgTypesSql, quote(t.Name))); err != nil {
+		return nil, fmt.Errorf("pg types: %v", err)
+	}
+	pgTypes := make(map[string]string, len(columns))
+	for _, column := range columns {
+		pgTypes[column.Name] = column.Type
+	}
+	return pgTypes, nil
+}
+
+// columnDecoder returns the Decoder of a column of the PostgreSQL type into a field of the Go type.
+func columnDecoder(pgType string, typ reflect.Type) Decoder {
+	decoders.RLock()
+	decoder := decoders.byPGType[pgType]
+	if decoder == nil {
+		decoder = decoders.byType[typ]
+	}
+	decoders.RUnlock()
+	if decoder != nil {
+		return decoder
+	}
+	if decoder, ok := defaultDecoders.Load(typ); ok {
+		return decoder.(Decoder)
+	}
+	decoder = defaultDecoder(typ)
+	defaultDecoders.Store(typ, decoder)
+	return decoder
+}
+
+var (
+	nullTimeType        = reflect.TypeOf(sql.NullTime{})
+	rawMessageType      = reflect.TypeOf(json.RawMessage{})
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonNull            = []byte("null")
+)
+
+func defaultDecoder(typ reflect.Type) Decoder {
+	if typ == timeType {
+		return func(field reflect.Value, raw []byte) error {
+			t, err := decodeTimestamp(raw)
+			if err == nil {
+				field.Set(reflect.ValueOf(t))
+			}
+			return err
+		}
+	}
+	if typ == nullTimeType {
+		return func(field reflect.Value, raw []byte) error {
+			t, err := decodeTimestamp(raw)
+			if err == nil {
+				field.Set(reflect.ValueOf(sql.NullTime{Time: t, Valid: true}))
+			}
+			return err
+		}
+	}
+	if reflect.PtrTo(typ).Implements(scannerType) {
+		return func(field reflect.Value, raw []byte) error {
+			src, err := scanSource(raw)
+			if err != nil {
+				return err
+			}
+			return field.Addr().Interface().(sql.Scanner).Scan(src)
+		}
+	}
+	if reflect.PtrTo(typ).Implements(jsonUnmarshalerType) ||
+		reflect.PtrTo(typ).Implements(textUnmarshalerType) {
+		return unmarshalJSON
+	}
+	switch {
+	case typ.Kind() == reflect.Ptr:
+		elemDecoder := columnDecoder("", typ.Elem())
+		return func(field reflect.Value, raw []byte) error {
+			elem := reflect.New(typ.Elem())
+			if err := elemDecoder(elem.Elem(), raw); err != nil {
+				return err
+			}
+			field.Set(elem)
+			return nil
+		}
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 && typ != rawMessageType:
+		return func(field reflect.Value, raw []byte) error {
+			if len(raw) == 0 || raw[0] != '"' {
+				field.SetBytes(append([]byte(nil), raw...))
+				return nil
+			}
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return err
+			}
+			// bytea is in hex format.
+			if len(s) < 2 || s[:2] != `\x` {
+				field.SetBytes([]byte(s))
+				return nil
+			}
+			b, err := hex.DecodeString(s[2:])
+			if err == nil {
+				field.SetBytes(b)
+			}
+			return err
+		}
+	default:
+		if decoder := basicDecoder(typ); decoder != nil {
+			return decoder
+		}
+		return unmarshalJSON
+	}
+}
+
+func unmarshalJSON(field reflect.Value, raw []byte) error {
+	return json.Unmarshal(raw, field.Addr().Interface())
+}
+
+// basicDecoder decodes the values of basic kinds without encoding/json, which is used if the value
+// is not of the usual form, so the result and error are the same.
+func basicDecoder(typ reflect.Type) Decoder {
+	switch typ.Kind() {
+	case reflect.Bool:
+		return func(field reflect.Value, raw []byte) error {
+			switch string(raw) {
+			case "true":
+				field.SetBool(true)
+			case "false":
+				field.SetBool(false)
+			default:
+				return unmarshalJSON(field, raw)
+			}
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(field reflect.Value, raw []byte) error {
+			n, err := strconv.ParseInt(string(raw), 10, typ.Bits())
+			if err != nil {
+				return unmarshalJSON(field, raw)
+			}
+			field.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(field reflect.Value, raw []byte) error {
+			n, err := strconv.ParseUint(string(raw), 10, typ.Bits())
+			if err != nil {
+				return unmarshalJSON(field, raw)
+			}
+			field.SetUint(n)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(field reflect.Value, raw []byte) error {
+			n, err := strconv.ParseFloat(string(raw), typ.Bits())
+			if err != nil {
+				return unmarshalJSON(field, raw)
+			}
+			field.SetFloat(n)
+			return nil
+		}
+	case reflect.String:
+		return func(field reflect.Value, raw []byte) error {
+			if len(raw) > 0 && (raw[0] == '{' || raw[0] == '[') {
+				// a json or jsonb column, its text is kept as it's loaded by "LoadSql".
+				field.SetString(string(raw))
+				return nil
+			}
+			if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' ||
+				bytes.IndexByte(raw, '\\') >= 0 || !utf8.Valid(raw) {
+				return unmarshalJSON(field, raw)
+			}
+			field.SetString(string(raw[1 : len(raw)-1]))
+			return nil
+		}
+	}
+	return nil
+}
+
+// decodeTimestamp parses the timestamp of "to_jsonb" like the text format, such as
+// "2006-01-02T15:04:05.999999" or "2006-01-02T15:04:05.999999+08:00".
+func decodeTimestamp(raw []byte) (time.Time, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return time.Time{}, err
+	}
+	if len(s) > 10 && s[10] == 'T' {
+		s = s[:10] + " " + s[11:]
+	}
+	return pq.ParseTimestamp(time.Local, s)
+}
+
+// scanSource converts the JSON value to the source of sql.Scanner, like a database driver does.
+func scanSource(raw []byte) (interface{}, error) {
+	switch raw[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return []byte(s), nil
+	case 't', 'f':
+		return raw[0] == 't', nil
+	default:
+		// a number, object or array.
+		return append([]byte(nil), raw...), nil
+	}
+}
@@ -0,0 +1,123 @@
+package pgcache
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type testDecimal string
+
+func (d *testDecimal) Scan(src interface{}) error {
+	*d = testDecimal(src.([]byte))
+	return nil
+}
+
+type testInterval time.Duration
+
+type testRange struct {
+	Lower, Upper int
+}
+
+type Event struct {
+	Id     int
+	Data   []byte
+	At     time.Time
+	Done   sql.NullTime
+	Amount testDecimal
+	Span   testInterval
+	Range  testRange
+	Note   *string
+}
+
+func init() {
+	RegisterDecoder(reflect.TypeOf(testInterval(0)), func(field reflect.Value, raw []byte) error {
+		var h, m, s int
+		if _, err := fmt.Sscanf(string(raw), `"%d:%d:%d"`, &h, &m, &s); err != nil {
+			return err
+		}
+		field.SetInt(int64(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+			time.Duration(s)*time.Second))
+		return nil
+	})
+}
+
+// decodeTestRange decodes a int4range such as "[1,10)".
+var decodeTestRange Decoder = func(field reflect.Value, raw []byte) error {
+	bounds := strings.Split(strings.Trim(string(raw), `"[]()`), ",")
+	lower, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return err
+	}
+	upper, err := strconv.Atoi(bounds[1])
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(testRange{Lower: lower, Upper: upper}))
+	return nil
+}
+
+func Example_decodeTypes() {
+	plan := testDecodePlan(Event{})
+	note := "old"
+	row := reflect.ValueOf(&Event{Note: &note}).Elem()
+	fmt.Println(plan.decode([]byte(`{
+		"id": 1, "data": "\\x68656c6c6f", "at": "2024-01-02T03:04:05.123456",
+		"done": "2024-01-02T03:04:05+08:00", "amount": 12345678901234567890.123456789,
+		"span": "01:30:00", "note": null
+	}`), row))
+	event := row.Interface().(Event)
+	fmt.Println(event.Id, string(event.Data), event.At.Format(time.RFC3339Nano))
+	fmt.Println(event.Done.Valid, event.Done.Time.Format(time.RFC3339Nano))
+	fmt.Println(event.Amount, time.Duration(event.Span), event.Note)
+
+	// a json column into a string field.
+	fmt.Println(plan.decode([]byte(`{"note": {"a": [1, "b"]}}`), row), *row.Interface().(Event).Note)
+
+	fmt.Println(plan.decode([]byte(`{"at": "yesterday"}`), row))
+	// Output:
+	// <nil>
+	// 1 hello 2024-01-02T03:04:05.123456Z
+	// true 2024-01-02T03:04:05+08:00
+	// 12345678901234567890.123456789 1h30m0s <nil>
+	// <nil> {"a": [1, "b"]}
+	// column at: invalid timestamp
+}
+
+// testPGTypesQuerier returns the PostgreSQL types of the columns.
+type testPGTypesQuerier struct {
+	testQuerier
+}
+
+func (q testPGTypesQuerier) Query(data interface{}, sql string, args ...interface{}) error {
+	if columns, ok := data.(*[]pgColumnType); ok {
+		*columns = []pgColumnType{{Name: "id", Type: "int4"}, {Name: "range", Type: "int4range"}}
+		return nil
+	}
+	return q.testQuerier.Query(data, sql, args...)
+}
+
+func ExampleRegisterPGDecoder() {
+	RegisterPGDecoder("int4range", decodeTestRange)
+	// the other tables needn't query the types.
+	defer delete(decoders.byPGType, "int4range")
+
+	var mutex sync.RWMutex
+	var m map[int]Event
+	t := &Table{
+		Name: "events", RowStruct: Event{},
+		Datas: []*Data{{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"Id"}}},
+	}
+	fmt.Println(t.init("db", testPGTypesQuerier{}, testLogger))
+	fmt.Println(t.pgTypes)
+	t.Create("", []byte(`{"id": 1, "range": "[2,5)"}`))
+	fmt.Println(m[1].Range)
+	// Output:
+	// <nil>
+	// map[id:int4 range:int4range]
+	// {2 5}
+}
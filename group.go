@@ -0,0 +1,94 @@
+package pgcache
+
+import (
+	"reflect"
+	"sync"
+)
+
+// dataGroup is the Datas sharing the same RWMutex. An event is applied to every Data of a group
+// in one critical section, so readers holding the lock never see a row in one Data but not in
+// another.
+type dataGroup struct {
+	mutex *sync.RWMutex
+	datas []*Data
+	// any of datas has Snapshot.
+	snapshot bool
+}
+
+// groupDatas groups the Datas by RWMutex, in the order of their first appearance.
+func groupDatas(datas []*Data) []*dataGroup {
+	var groups []*dataGroup
+	var byMutex = make(map[*sync.RWMutex]*dataGroup)
+	for _, d := range datas {
+		if d.sharded != nil {
+			// each shard has its own lock.
+			groups = append(groups, &dataGroup{datas: []*Data{d}})
+			continue
+		}
+		g := byMutex[d.RWMutex]
+		if g == nil {
+			g = &dataGroup{mutex: d.RWMutex}
+			byMutex[d.RWMutex] = g
+			groups = append(groups, g)
+		}
+		g.datas = append(g.datas, d)
+		g.snapshot = g.snapshot || d.snapshot != nil
+	}
+	return groups
+}
+
+// lock locks the group for the rows, or the whole group if no rows. It returns the unlock function.
+func (g *dataGroup) lock(rows ...reflect.Value) func() {
+	return g.datas[0].lock(rows...)
+}
+
+func (g *dataGroup) save(row reflect.Value) {
+	defer g.lock(row)()
+	for _, d := range g.datas {
+		d.saveLocked(row)
+	}
+}
+
+func (g *dataGroup) remove(row reflect.Value) {
+	unlock := g.lock(row)
+	for _, d := range g.datas {
+		d.removeLocked(row)
+	}
+	unlock()
+	g.refill()
+}
+
+// update removes the old row and saves the new row, readers never see the row missing.
+func (g *dataGroup) update(oldRow, newRow reflect.Value, changed []bool) {
+	unlock := g.lock(oldRow, newRow)
+	for _, d := range g.datas {
+		d.updateLocked(oldRow, newRow, changed)
+	}
+	unlock()
+	g.refill()
+}
+
+// refill refills the truncated sets by querying database, out of the lock.
+func (g *dataGroup) refill() {
+	for _, d := range g.datas {
+		d.refillByQuery()
+	}
+}
+
+func (g *dataGroup) clear() {
+	defer g.lock()()
+	for _, d := range g.datas {
+		d.clearLocked()
+	}
+}
+
+// publish publishes the changes of the Datas which has Snapshot.
+func (g *dataGroup) publish() {
+	if !g.snapshot {
+		return
+	}
+	defer g.lock()()
+	for _, d := range g.datas {
+		d.publish()
+	}
+}
@@ -0,0 +1,59 @@
+package pgcache
+
+import (
+	"fmt"
+	"sync"
+)
+
+func Example_groupDatas() {
+	var mutex1, mutex2 sync.RWMutex
+	datas := []*Data{
+		{RWMutex: &mutex1}, {RWMutex: &mutex2}, {RWMutex: &mutex1},
+	}
+	for _, g := range groupDatas(datas) {
+		fmt.Println(g.mutex == &mutex1, len(g.datas), g.datas[0] == datas[0])
+	}
+	// Output:
+	// true 2 true
+	// false 1 false
+}
+
+func ExampleTable_atomicUpdate() {
+	var mutex sync.RWMutex
+	var byStudent map[int]map[string]int
+	var bySubject map[string]map[int]int
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &byStudent, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+			{RWMutex: &mutex, DataPtr: &bySubject, MapKeys: []string{"Subject", "StudentId"}, Value: "Score"},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "数学", "Score": 0}`))
+
+	var done = make(chan struct{})
+	var consistent = true
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			mutex.RLock()
+			if byStudent[1001]["数学"] != bySubject["数学"][1001] || len(byStudent) != 2 {
+				consistent = false
+			}
+			mutex.RUnlock()
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		t.Update("",
+			[]byte(fmt.Sprintf(`{"StudentId": 1001, "Subject": "数学", "Score": %d}`, i)),
+			[]byte(fmt.Sprintf(`{"StudentId": 1001, "Subject": "数学", "Score": %d}`, i+1)),
+		)
+	}
+	<-done
+	fmt.Println(consistent, byStudent[1001]["数学"], bySubject["数学"][1001])
+	// Output:
+	// <nil>
+	// true 1000 1000
+}
@@ -0,0 +1,83 @@
+package pgcache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Row hooks. They're implemented by RowStruct or a pointer to RowStruct, and run once for each row
+// loaded or received, before the row is saved to or removed from Datas, in the order of
+// "AfterLoad", "BeforeCache", "Validate". They're different from "Data.Preprocess" and
+// "Data.Precond", which run once for each Data.
+//
+// Rows restored from "SnapshotFile" have been processed by the hooks before, and so has the new
+// row of an update if "RowStore" is true, since it's the stored row with the changed columns set.
+// So the hooks should be idempotent in these cases.
+
+// AfterLoader is called after a row is decoded. The context is canceled after the table is
+// removed from DB.
+type AfterLoader interface {
+	AfterLoad(ctx context.Context)
+}
+
+// BeforeCacher is called before a row is cached, it can modify the row. If it returns an error,
+// the row is not saved, and the error is logged.
+type BeforeCacher interface {
+	BeforeCache() error
+}
+
+// Validator is called before a row is saved. If it returns an error, the row is not saved, and
+// the error is logged. If it's the new row of an update, the old row is removed.
+type Validator interface {
+	Validate() error
+}
+
+var (
+	afterLoaderType  = reflect.TypeOf((*AfterLoader)(nil)).Elem()
+	beforeCacherType = reflect.TypeOf((*BeforeCacher)(nil)).Elem()
+	validatorType    = reflect.TypeOf((*Validator)(nil)).Elem()
+)
+
+func (t *Table) initHooks() {
+	ptrType := reflect.PtrTo(t.rowStruct)
+	t.hasHooks = ptrType.Implements(afterLoaderType) || ptrType.Implements(beforeCacherType) ||
+		ptrType.Implements(validatorType)
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+}
+
+// prepareRow runs the hooks on the row. If saving is true, it returns false if the row should not
+// be saved. If saving is false, the row is to be removed, so "Validate" is not called, and it
+// always returns true.
+func (t *Table) prepareRow(row reflect.Value, saving bool) bool {
+	if !t.hasHooks {
+		return true
+	}
+	ptr := row.Addr().Interface()
+	if hook, ok := ptr.(AfterLoader); ok {
+		hook.AfterLoad(t.ctx)
+	}
+	if hook, ok := ptr.(BeforeCacher); ok {
+		if err := hook.BeforeCache(); err != nil {
+			t.Error(fmt.Sprintf("BeforeCache: %v, row: %+v", err, row.Interface()))
+			if saving {
+				return false
+			}
+		}
+	}
+	if hook, ok := ptr.(Validator); ok && saving {
+		if err := hook.Validate(); err != nil {
+			t.Error(fmt.Sprintf("Validate: %v, row: %+v", err, row.Interface()))
+			return false
+		}
+	}
+	return true
+}
+
+// markRemoved is called after the table is removed from DB.
+func (t *Table) markRemoved() {
+	close(t.removed)
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
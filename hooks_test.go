@@ -0,0 +1,86 @@
+package pgcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type HookedScore struct {
+	StudentId int
+	Subject   string
+	Score     int
+	loaded    bool
+}
+
+func (s *HookedScore) AfterLoad(ctx context.Context) {
+	s.loaded = ctx.Err() == nil
+}
+
+func (s *HookedScore) BeforeCache() error {
+	if s.Subject == "" {
+		return errors.New("empty subject")
+	}
+	s.Subject = strings.TrimSpace(s.Subject)
+	return nil
+}
+
+func (s *HookedScore) Validate() error {
+	if s.Score < 0 || s.Score > 100 {
+		return fmt.Errorf("invalid score: %d", s.Score)
+	}
+	return nil
+}
+
+func ExampleTable_rowHooks() {
+	var m map[string]map[int]HookedScore
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: HookedScore{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"Subject", "StudentId"}},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	ch := t.Watch(context.Background(), nil)
+
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": " 语文 ", "Score": 95}`))
+	t.Create("", []byte(`{"StudentId": 1002, "Subject": "", "Score": 96}`))
+	t.Create("", []byte(`{"StudentId": 1003, "Subject": "语文", "Score": 101}`))
+	fmt.Println(m)
+
+	t.Update("",
+		[]byte(`{"StudentId": 1001, "Subject": " 语文 ", "Score": 95}`),
+		[]byte(`{"StudentId": 1001, "Subject": " 语文 ", "Score": 96}`),
+	)
+	fmt.Println(m)
+	// the new row is invalid, so the old row is removed.
+	t.Update("",
+		[]byte(`{"StudentId": 1001, "Subject": " 语文 ", "Score": 96}`),
+		[]byte(`{"StudentId": 1001, "Subject": " 语文 ", "Score": -1}`),
+	)
+	fmt.Println(m)
+
+	t.Save([]HookedScore{{StudentId: 1004, Subject: " 数学", Score: 90}, {StudentId: 1005}})
+	fmt.Println(m)
+	t.Remove([]HookedScore{{StudentId: 1004, Subject: "数学 "}})
+	fmt.Println(m)
+
+	for i := 0; i < 3; i++ {
+		event := <-ch
+		fmt.Println(event.Type, event.Old, event.New)
+	}
+
+	// Output:
+	// <nil>
+	// map[语文:map[1001:{1001 语文 95 true}]]
+	// map[语文:map[1001:{1001 语文 96 true}]]
+	// map[语文:map[]]
+	// map[数学:map[1004:{1004 数学 90 true}] 语文:map[]]
+	// map[数学:map[] 语文:map[]]
+	// create <nil> {1001 语文 95 true}
+	// update {1001 语文 95 true} {1001 语文 96 true}
+	// delete {1001 语文 96 true} <nil>
+}
@@ -0,0 +1,293 @@
+package pgcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OrderedIndex is a Data container which keeps values ordered by "Data.IndexKeys", it's backed by
+// a B-tree. Its methods can be called after the table is inited, they take the read lock of the Data.
+type OrderedIndex struct {
+	mutex *sync.RWMutex
+	tree  *btree
+	// types of the fields to order by, including "IndexUniqueKey".
+	keyTypes []reflect.Type
+	// field names of keyTypes.
+	keyFields []string
+}
+
+type indexItem struct {
+	keys  []interface{}
+	value interface{}
+}
+
+var orderedIndexType = reflect.TypeOf(OrderedIndex{})
+
+func (d *Data) checkIndex(rowStruct reflect.Type) error {
+	if len(d.IndexKeys) == 0 {
+		return errors.New("Data.IndexKeys is required for a OrderedIndex.")
+	}
+	if len(d.MapKeys) > 0 {
+		return errors.New("Data.DataPtr is a OrderedIndex, so Data.MapKeys should be empty.")
+	}
+	if _, err := d.initValueGetter(rowStruct); err != nil {
+		return err
+	}
+	if len(d.IndexUniqueKey) == 0 {
+		if _, ok := rowStruct.FieldByName("Id"); ok {
+			d.IndexUniqueKey = []string{"Id"}
+		} else {
+			return errors.New("Data.IndexUniqueKey is required.")
+		}
+	}
+
+	index := d.dataV.Addr().Interface().(*OrderedIndex)
+	index.mutex = d.RWMutex
+	index.keyTypes, index.keyFields = nil, nil
+	for j, names := range [][]string{d.IndexKeys, d.IndexUniqueKey} {
+		fieldName := [...]string{"Data.IndexKeys", "Data.IndexUniqueKey"}[j]
+		for i, name := range names {
+			field, ok := rowStruct.FieldByName(name)
+			if !ok {
+				return fmt.Errorf("%s[%d]: %s, no such field in row struct.", fieldName, i, name)
+			}
+			if !isOrderedType(field.Type) {
+				return fmt.Errorf("%s[%d]: %s, type %v is not orderable.", fieldName, i, name, field.Type)
+			}
+			index.keyTypes = append(index.keyTypes, field.Type)
+			index.keyFields = append(index.keyFields, name)
+		}
+	}
+	index.tree = newBtree(func(a, b *indexItem) bool {
+		return compareIndexKeys(a.keys, b.keys) < 0
+	})
+	d.index = index
+	return nil
+}
+
+func isOrderedType(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String, reflect.Bool:
+		return true
+	}
+	return typ == timeType
+}
+
+// saveToIndex should be called with the lock held.
+func (d *Data) saveToIndex(row reflect.Value) {
+	d.index.tree.replaceOrInsert(&indexItem{
+		keys: d.index.rowKeys(row), value: d.getValue(row).Interface(),
+	})
+}
+
+// removeFromIndex should be called with the lock held.
+func (d *Data) removeFromIndex(row reflect.Value) {
+	d.index.tree.delete(&indexItem{keys: d.index.rowKeys(row)})
+}
+
+func (x *OrderedIndex) rowKeys(row reflect.Value) []interface{} {
+	var keys = make([]interface{}, len(x.keyFields))
+	for i, name := range x.keyFields {
+		keys[i] = normalizeIndexKey(row.FieldByName(name))
+	}
+	return keys
+}
+
+// convertKeys converts the keys to search to the types of the fields.
+func (x *OrderedIndex) convertKeys(method string, keys []interface{}) ([]interface{}, error) {
+	if len(keys) > len(x.keyTypes) {
+		return nil, fmt.Errorf(
+			"OrderedIndex.%s: expect at most %d keys, got %d.", method, len(x.keyTypes), len(keys),
+		)
+	}
+	var result = make([]interface{}, len(keys))
+	for i, key := range keys {
+		v, ok := convertKey(reflect.ValueOf(key), x.keyTypes[i])
+		if !ok {
+			return nil, fmt.Errorf(
+				"OrderedIndex.%s: keys[%d]: %v is not convertible to %v.", method, i, key, x.keyTypes[i],
+			)
+		}
+		result[i] = normalizeIndexKey(v)
+	}
+	return result, nil
+}
+
+func normalizeIndexKey(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	default:
+		return v.Interface().(time.Time)
+	}
+}
+
+// compareIndexKeys compares a and b by the leading keys of the shorter one.
+func compareIndexKeys(a, b []interface{}) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareIndexKey(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareIndexKey(a, b interface{}) int {
+	switch x := a.(type) {
+	case int64:
+		return compareInt(x < b.(int64), x > b.(int64))
+	case uint64:
+		return compareInt(x < b.(uint64), x > b.(uint64))
+	case float64:
+		return compareInt(x < b.(float64), x > b.(float64))
+	case string:
+		return strings.Compare(x, b.(string))
+	case bool:
+		return compareInt(!x && b.(bool), x && !b.(bool))
+	default:
+		y := b.(time.Time)
+		return compareInt(x.(time.Time).Before(y), x.(time.Time).After(y))
+	}
+}
+
+func compareInt(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// Len returns the number of values in the index.
+func (x *OrderedIndex) Len() int {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	return x.tree.length
+}
+
+// Ascend calls fn for every value in ascending order, until fn returns false.
+func (x *OrderedIndex) Ascend(fn func(value interface{}) bool) {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	x.tree.ascend(nil, func(item *indexItem) bool { return fn(item.value) })
+}
+
+// Descend calls fn for every value in descending order, until fn returns false.
+func (x *OrderedIndex) Descend(fn func(value interface{}) bool) {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	x.tree.descend(nil, func(item *indexItem) bool { return fn(item.value) })
+}
+
+// Seek calls fn in ascending order for the values whose keys are greater than or equal to keys,
+// until fn returns false. The keys are compared by the leading "IndexKeys" of the same length.
+func (x *OrderedIndex) Seek(keys []interface{}, fn func(value interface{}) bool) error {
+	from, err := x.convertKeys("Seek", keys)
+	if err != nil {
+		return err
+	}
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	x.tree.ascend(func(item *indexItem) bool {
+		return compareIndexKeys(item.keys, from) >= 0
+	}, func(item *indexItem) bool { return fn(item.value) })
+	return nil
+}
+
+// SeekReverse calls fn in descending order for the values whose keys are less than or equal to
+// keys, until fn returns false. The keys are compared by the leading "IndexKeys" of the same length.
+func (x *OrderedIndex) SeekReverse(keys []interface{}, fn func(value interface{}) bool) error {
+	to, err := x.convertKeys("SeekReverse", keys)
+	if err != nil {
+		return err
+	}
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	x.tree.descend(func(item *indexItem) bool {
+		return compareIndexKeys(item.keys, to) <= 0
+	}, func(item *indexItem) bool { return fn(item.value) })
+	return nil
+}
+
+// Range calls fn in ascending order for the values whose keys are in [from, to), until fn returns
+// false. A nil from or to means unbounded.
+func (x *OrderedIndex) Range(from, to []interface{}, fn func(value interface{}) bool) error {
+	fromKeys, err := x.convertKeys("Range", from)
+	if err != nil {
+		return err
+	}
+	toKeys, err := x.convertKeys("Range", to)
+	if err != nil {
+		return err
+	}
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	x.tree.ascend(func(item *indexItem) bool {
+		return compareIndexKeys(item.keys, fromKeys) >= 0
+	}, func(item *indexItem) bool {
+		if to != nil && compareIndexKeys(item.keys, toKeys) >= 0 {
+			return false
+		}
+		return fn(item.value)
+	})
+	return nil
+}
+
+// Page returns at most limit values in ascending order whose keys are greater than after.
+// A nil after means from the first value. To get the next page, use the keys of the last value
+// returned as after.
+func (x *OrderedIndex) Page(after []interface{}, limit int) ([]interface{}, error) {
+	afterKeys, err := x.convertKeys("Page", after)
+	if err != nil {
+		return nil, err
+	}
+	var result []interface{}
+	if limit <= 0 {
+		return result, nil
+	}
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	var from func(*indexItem) bool
+	if after != nil {
+		from = func(item *indexItem) bool { return compareIndexKeys(item.keys, afterKeys) > 0 }
+	}
+	x.tree.ascend(from, func(item *indexItem) bool {
+		result = append(result, item.value)
+		return len(result) < limit
+	})
+	return result, nil
+}
+
+// MarshalJSON marshals the values in ascending order.
+func (x *OrderedIndex) MarshalJSON() ([]byte, error) {
+	var values = []interface{}{}
+	if x.tree != nil {
+		x.Ascend(func(value interface{}) bool {
+			values = append(values, value)
+			return true
+		})
+	}
+	return json.Marshal(values)
+}
+
+// clear should be called with the lock held.
+func (x *OrderedIndex) clear() {
+	x.tree = newBtree(x.tree.less)
+}
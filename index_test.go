@@ -0,0 +1,130 @@
+package pgcache
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+)
+
+func ExampleOrderedIndex() {
+	var index OrderedIndex
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{{
+			RWMutex: &mutex, DataPtr: &index, IndexKeys: []string{"Score"},
+			IndexUniqueKey: []string{"StudentId", "Subject"}, Value: "StudentId",
+		}},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Save([]Score{
+		{StudentId: 1001, Subject: "语文", Score: 80},
+		{StudentId: 1002, Subject: "语文", Score: 95},
+		{StudentId: 1003, Subject: "语文", Score: 60},
+		{StudentId: 1004, Subject: "语文", Score: 80},
+		{StudentId: 1005, Subject: "语文", Score: 70},
+	})
+	t.Update("",
+		[]byte(`{"StudentId": 1003, "Subject": "语文", "Score": 60}`),
+		[]byte(`{"StudentId": 1003, "Subject": "语文", "Score": 99}`),
+	)
+	t.Delete("", []byte(`{"StudentId": 1005, "Subject": "语文", "Score": 70}`))
+
+	var values []interface{}
+	var collect = func(value interface{}) bool {
+		values = append(values, value)
+		return true
+	}
+	var print = func(err error) {
+		fmt.Println(values, err)
+		values = nil
+	}
+	fmt.Println(index.Len(), t.Datas[0].Size(), t.Datas[0].Key())
+	index.Ascend(collect)
+	print(nil)
+	index.Descend(collect)
+	print(nil)
+	print(index.Range([]interface{}{80}, []interface{}{99}, collect))
+	print(index.Seek([]interface{}{81}, collect))
+	print(index.SeekReverse([]interface{}{80, 1001}, collect))
+	print(index.Range([]interface{}{"x"}, nil, collect))
+	fmt.Println(index.Page(nil, 2))
+	fmt.Println(index.Page([]interface{}{80, 1004, "语文"}, 2))
+
+	t.Clear()
+	fmt.Println(index.Len())
+	// Output:
+	// <nil>
+	// 4 4 pgcache.OrderedIndex[Score]StudentId
+	// [1001 1004 1002 1003] <nil>
+	// [1003 1002 1004 1001] <nil>
+	// [1001 1004 1002] <nil>
+	// [1002 1003] <nil>
+	// [1001] <nil>
+	// [] OrderedIndex.Range: keys[0]: x is not convertible to int.
+	// [1001 1004] <nil>
+	// [1002 1003] <nil>
+	// 0
+}
+
+func ExampleData_init_invalidIndex() {
+	var mutex sync.RWMutex
+	for _, d := range []Data{
+		{RWMutex: &mutex, DataPtr: &OrderedIndex{}},
+		{RWMutex: &mutex, DataPtr: &OrderedIndex{}, IndexKeys: []string{"Other"},
+			IndexUniqueKey: []string{"StudentId"}},
+		{RWMutex: &mutex, DataPtr: &OrderedIndex{}, IndexKeys: []string{"Score"},
+			IndexUniqueKey: []string{"StudentId", "Valid"}},
+		{RWMutex: &mutex, DataPtr: &OrderedIndex{}, IndexKeys: []string{"Score"}},
+		{RWMutex: &mutex, DataPtr: &map[int]int{}, MapKeys: []string{"StudentId"},
+			IndexKeys: []string{"Score"}},
+	} {
+		fmt.Println(d.init(reflect.TypeOf(Score{})))
+	}
+	// Output:
+	// Data.IndexKeys is required for a OrderedIndex.
+	// Data.IndexKeys[0]: Other, no such field in row struct.
+	// Data.IndexUniqueKey[1]: Valid, no such field in row struct.
+	// Data.IndexUniqueKey is required.
+	// Data.IndexKeys should be empty, if Data.DataPtr is not a OrderedIndex.
+}
+
+func Example_btree() {
+	tree := newBtree(func(a, b *indexItem) bool {
+		return compareIndexKeys(a.keys, b.keys) < 0
+	})
+	tree.degree = 2
+	var r = rand.New(rand.NewSource(1))
+	var set = make(map[int64]bool)
+	for i := 0; i < 2000; i++ {
+		n := r.Int63n(500)
+		if r.Intn(3) == 0 {
+			tree.delete(&indexItem{keys: []interface{}{n}})
+			delete(set, n)
+		} else {
+			tree.replaceOrInsert(&indexItem{keys: []interface{}{n}})
+			set[n] = true
+		}
+	}
+	var last int64 = -1
+	var ordered, count = true, 0
+	tree.ascend(nil, func(item *indexItem) bool {
+		n := item.keys[0].(int64)
+		ordered = ordered && n > last && set[n]
+		last = n
+		count++
+		return true
+	})
+	tree.descend(nil, func(item *indexItem) bool {
+		n := item.keys[0].(int64)
+		ordered = ordered && n == last
+		last--
+		for last >= 0 && !set[last] {
+			last--
+		}
+		return true
+	})
+	fmt.Println(ordered, count == len(set), tree.length == len(set))
+	// Output: true true true
+}
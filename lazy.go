@@ -0,0 +1,315 @@
+package pgcache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/lovego/bsql"
+)
+
+// LazyOptions makes a table read-through. Datas start empty, and the rows of a key are loaded from
+// database by the first "Data.Get" of the key. Changes notified are applied only to the keys
+// already cached.
+type LazyOptions struct {
+	// MaxKeys is the max number of keys cached in a Data, the least recently used keys are evicted.
+	// Zero means no limit.
+	MaxKeys int
+	// NegativeCache makes the keys which have no rows cached too, so they are not loaded again.
+	NegativeCache bool
+}
+
+// the keys cached in a lazy Data.
+type lazyData struct {
+	*LazyOptions
+	// types of the map keys in each layer.
+	keyTypes []reflect.Type
+	// comparable type of an array of all layers' keys.
+	keyType reflect.Type
+	entries map[interface{}]*list.Element
+	lru     *list.List
+	// sql to load rows of a key.
+	loadSql string
+}
+
+type lazyEntry struct {
+	key  interface{}
+	keys []reflect.Value
+	// the rows of the key is being loaded.
+	loading bool
+	// closed when the loading is done, and err is the error of it.
+	loaded chan struct{}
+	err    error
+	// the key is changed while loading.
+	changed bool
+	// the key has no rows.
+	negative bool
+}
+
+// the times to load a key again if it's changed while loading. If it's still changed after the
+// retries, the key is not cached, and "Data.Get" returns an error.
+const lazyLoadRetries = 3
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+func (d *Data) initLazy(t *Table) error {
+	if d.dataV.Kind() != reflect.Map || d.sharded != nil {
+		return errors.New("Data.DataPtr should be a map for a lazy table.")
+	}
+	if d.fanOut != nil {
+		return errors.New("Data.MapKeys: slice field is not supported for a lazy table.")
+	}
+	for i, g := range d.keyGetters {
+		// the keys are loaded by the columns.
+		if !g.isField {
+			return fmt.Errorf("Data.MapKeys[%d]: %s, should be a field for a lazy table.", i, d.MapKeys[i])
+		}
+	}
+	var keyTypes []reflect.Type
+	for typ := d.dataV.Type(); typ.Kind() == reflect.Map && len(keyTypes) < len(d.MapKeys); {
+		keyTypes = append(keyTypes, typ.Key())
+		typ = typ.Elem()
+	}
+	var conds []string
+	for _, key := range d.MapKeys {
+		conds = append(conds, quoteColumn(t.column(key).name)+" = %s")
+	}
+	d.lazy = &lazyData{
+		LazyOptions: t.Lazy,
+		keyTypes:    keyTypes,
+		keyType:     reflect.ArrayOf(len(keyTypes), interfaceType),
+		entries:     make(map[interface{}]*list.Element),
+		lru:         list.New(),
+		loadSql: fmt.Sprintf("SELECT * FROM (%s) AS t WHERE ", t.LoadSql) +
+			strings.Join(conds, " AND "),
+	}
+	return nil
+}
+
+// Get returns the value of the keys, the number of keys should be the same as MapKeys. A map or
+// slice value is returned as a copy.
+// If the table is lazy and the keys are not cached, the rows of the keys are loaded first, and the
+// concurrent Gets of the keys wait for the same loading.
+func (d *Data) Get(keys ...interface{}) (interface{}, bool, error) {
+	if d.sharded != nil {
+		return d.sharded.Get(keys...)
+	}
+	if d.dataV.Kind() != reflect.Map {
+		return nil, false, errors.New("Data.Get: DataPtr is not a map.")
+	}
+	if len(keys) != len(d.MapKeys) {
+		return nil, false, fmt.Errorf(
+			"Data.Get: expect %d keys, got %d.", len(d.MapKeys), len(keys),
+		)
+	}
+	keyValues, err := d.convertKeys(keys)
+	if err != nil {
+		return nil, false, err
+	}
+	if d.lazy == nil {
+		d.RLock()
+		defer d.RUnlock()
+		return d.lookup(keyValues)
+	}
+
+	d.Lock()
+	entry, key := d.lazy.get(keyValues)
+	if entry != nil && !entry.loading {
+		d.lazy.lru.MoveToFront(d.lazy.entries[key])
+		defer d.Unlock()
+		return d.lookup(keyValues)
+	}
+	if entry != nil {
+		d.Unlock()
+		<-entry.loaded
+		if entry.err != nil {
+			return nil, false, entry.err
+		}
+		d.RLock()
+		defer d.RUnlock()
+		return d.lookup(keyValues)
+	}
+	entry = &lazyEntry{key: key, keys: keyValues, loading: true, loaded: make(chan struct{})}
+	d.lazy.entries[key] = d.lazy.lru.PushFront(entry)
+	d.Unlock()
+
+	return d.loadKey(entry)
+}
+
+func (d *Data) loadKey(entry *lazyEntry) (interface{}, bool, error) {
+	var params = make([]interface{}, len(entry.keys))
+	for i := range entry.keys {
+		params[i] = bsql.V(entry.keys[i].Interface())
+	}
+	sql := fmt.Sprintf(d.lazy.loadSql, params...)
+
+	defer close(entry.loaded)
+	for i := 0; ; i++ {
+		var rows = reflect.New(reflect.SliceOf(d.table.rowStruct)).Elem()
+		if err := d.table.dbQuerier.Query(rows.Addr().Interface(), sql); err != nil {
+			return nil, false, d.loadFailed(entry, err)
+		}
+		d.Lock()
+		if entry.changed {
+			if i < lazyLoadRetries {
+				entry.changed = false
+				d.Unlock()
+				continue
+			}
+			d.Unlock()
+			return nil, false, d.loadFailed(entry, fmt.Errorf(
+				"Data.Get: keys %v are changed while loading for %d times.", entry.key, i+1,
+			))
+		}
+		d.removeKey(entry.keys)
+		for j := 0; j < rows.Len(); j++ {
+			row := rows.Index(j)
+			if !d.table.prepareRow(row, true) {
+				continue
+			}
+			d.preprocess(row)
+			if d.precond(row) {
+				d.saveRow(row)
+			}
+		}
+		entry.loading, entry.changed = false, false
+		entry.negative = rows.Len() == 0
+		if entry.negative && !d.lazy.NegativeCache {
+			d.lazy.remove(entry.key)
+		}
+		d.lazy.evict(d)
+		defer d.Unlock()
+		return d.lookup(entry.keys)
+	}
+}
+
+// loadFailed records the error of the loading, and removes the key, so it's loaded again by the
+// next Get.
+func (d *Data) loadFailed(entry *lazyEntry, err error) error {
+	d.Lock()
+	defer d.Unlock()
+	entry.loading, entry.err = false, err
+	d.lazy.remove(entry.key)
+	return err
+}
+
+// tracked reports if the key of the row is cached, only changes of cached keys are applied.
+// It should be called with the lock held.
+func (d *Data) tracked(row reflect.Value) bool {
+	var keys = make([]reflect.Value, len(d.MapKeys))
+	for i, g := range d.keyGetters {
+		keys[i] = g.get(row).Convert(d.lazy.keyTypes[i])
+	}
+	entry, _ := d.lazy.get(keys)
+	if entry == nil {
+		return false
+	}
+	if entry.loading {
+		entry.changed = true
+		return false
+	}
+	entry.negative = false
+	return true
+}
+
+func (d *Data) convertKeys(keys []interface{}) ([]reflect.Value, error) {
+	var result = make([]reflect.Value, len(keys))
+	typ := d.dataV.Type()
+	for i, key := range keys {
+		v, ok := convertKey(reflect.ValueOf(key), typ.Key())
+		if !ok {
+			return nil, fmt.Errorf(
+				"Data.Get: keys[%d]: %v is not convertible to %v.", i, key, typ.Key(),
+			)
+		}
+		result[i] = v
+		typ = typ.Elem()
+	}
+	return result, nil
+}
+
+// lookup should be called with the lock held.
+func (d *Data) lookup(keys []reflect.Value) (interface{}, bool, error) {
+	value := d.dataV
+	for _, key := range keys {
+		if value.IsNil() {
+			return nil, false, nil
+		}
+		if value = value.MapIndex(key); !value.IsValid() {
+			return nil, false, nil
+		}
+	}
+	// a copy, so it's not changed by the later saves.
+	return cloneContainer(value).Interface(), true, nil
+}
+
+// removeKey should be called with the lock held.
+func (d *Data) removeKey(keys []reflect.Value) {
+	if d.aggregate != nil {
+		array := reflect.New(d.aggregate.groupKeyType).Elem()
+		for i := range keys {
+			array.Index(i).Set(keys[i])
+		}
+		delete(d.aggregate.groups, array.Interface())
+	}
+	mapV := d.dataV
+	for i := 0; i < len(keys)-1; i++ {
+		if mapV = mapV.MapIndex(keys[i]); !mapV.IsValid() || mapV.IsNil() {
+			return
+		}
+	}
+	if !mapV.IsNil() {
+		mapV.SetMapIndex(keys[len(keys)-1], reflect.Value{})
+	}
+	if d.sortOrder != nil {
+		d.sortOrder.removeSet(mapKeysArray(keys))
+	}
+}
+
+func (l *lazyData) get(keys []reflect.Value) (*lazyEntry, interface{}) {
+	array := reflect.New(l.keyType).Elem()
+	for i := range keys {
+		array.Index(i).Set(keys[i])
+	}
+	key := array.Interface()
+	if elem := l.entries[key]; elem != nil {
+		return elem.Value.(*lazyEntry), key
+	}
+	return nil, key
+}
+
+func (l *lazyData) remove(key interface{}) {
+	if elem := l.entries[key]; elem != nil {
+		l.lru.Remove(elem)
+		delete(l.entries, key)
+	}
+}
+
+// evict the least recently used keys, it should be called with the lock held.
+func (l *lazyData) evict(d *Data) {
+	if l.MaxKeys <= 0 {
+		return
+	}
+	for elem := l.lru.Back(); elem != nil && l.lru.Len() > l.MaxKeys; {
+		prev := elem.Prev()
+		if entry := elem.Value.(*lazyEntry); !entry.loading {
+			d.removeKey(entry.keys)
+			l.lru.Remove(elem)
+			delete(l.entries, entry.key)
+		}
+		elem = prev
+	}
+}
+
+func (l *lazyData) clear() {
+	for key, elem := range l.entries {
+		if entry := elem.Value.(*lazyEntry); entry.loading {
+			entry.changed = true
+		} else {
+			l.lru.Remove(elem)
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package pgcache
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type lazyQuerier struct {
+	scores []Score
+}
+
+var studentIdRegexp = regexp.MustCompile(`student_id = (\d+)`)
+
+func (q lazyQuerier) Query(data interface{}, sql string, args ...interface{}) error {
+	fmt.Println(sql)
+	id, _ := strconv.Atoi(studentIdRegexp.FindStringSubmatch(sql)[1])
+	rows := data.(*[]Score)
+	for _, score := range q.scores {
+		if score.StudentId == id {
+			*rows = append(*rows, score)
+		}
+	}
+	return nil
+}
+
+func (q lazyQuerier) GetDB() *sql.DB {
+	return nil
+}
+
+func ExampleData_Get_lazy() {
+	var m map[int][]Score
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Lazy: &LazyOptions{MaxKeys: 2, NegativeCache: true},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"},
+				SortedSetUniqueKey: []string{"Subject"}},
+		},
+	}
+	fmt.Println(t.init("db", lazyQuerier{[]Score{
+		{StudentId: 1001, Subject: "语文", Score: 90},
+		{StudentId: 1001, Subject: "数学", Score: 95},
+		{StudentId: 1002, Subject: "语文", Score: 80},
+	}}, testLogger))
+	t.Init("")
+	d := t.Datas[0]
+
+	fmt.Println(d.Get(1001))
+	got, ok, err := d.Get(int64(1001)) // cached
+	fmt.Println(got, ok, err)
+	fmt.Println(d.Get(1003))        // negative cached
+	fmt.Println(d.Get(1003))
+
+	// only changes of cached keys are applied.
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "英语", "Score": 85}`))
+	t.Create("", []byte(`{"StudentId": 1002, "Subject": "英语", "Score": 85}`))
+	t.Create("", []byte(`{"StudentId": 1003, "Subject": "英语", "Score": 70}`))
+	fmt.Println(m)
+	fmt.Println(got) // not changed
+
+	// 1001 is evicted.
+	fmt.Println(d.Get(1002))
+	fmt.Println(m)
+
+	// Output:
+	// <nil>
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE student_id = 1001
+	// [{1001 数学 95} {1001 语文 90}] true <nil>
+	// [{1001 数学 95} {1001 语文 90}] true <nil>
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE student_id = 1003
+	// <nil> false <nil>
+	// <nil> false <nil>
+	// map[1001:[{1001 数学 95} {1001 英语 85} {1001 语文 90}] 1003:[{1003 英语 70}]]
+	// [{1001 数学 95} {1001 语文 90}]
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE student_id = 1002
+	// [{1002 语文 80}] true <nil>
+	// map[1002:[{1002 语文 80}] 1003:[{1003 英语 70}]]
+}
+
+// hookedLazyQuerier calls the hook before each query.
+type hookedLazyQuerier struct {
+	lazyQuerier
+	queries *int32
+	hook    func()
+}
+
+func (q hookedLazyQuerier) Query(data interface{}, sql string, args ...interface{}) error {
+	atomic.AddInt32(q.queries, 1)
+	q.hook()
+	return q.lazyQuerier.Query(data, sql, args...)
+}
+
+func ExampleData_Get_lazyLoading() {
+	var m map[int][]Score
+	var mutex sync.RWMutex
+	var queries int32
+	var hook func()
+	t := &Table{
+		Name: "scores", RowStruct: Score{}, Lazy: &LazyOptions{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"},
+				SortedSetUniqueKey: []string{"Subject"}},
+		},
+	}
+	fmt.Println(t.init("db", hookedLazyQuerier{lazyQuerier{[]Score{
+		{StudentId: 1001, Subject: "语文", Score: 90},
+	}}, &queries, func() { hook() }}, testLogger))
+	t.Init("")
+	d := t.Datas[0]
+
+	// the concurrent Gets wait for the same loading.
+	release := make(chan struct{})
+	hook = func() { <-release }
+	var wg sync.WaitGroup
+	var results [3]interface{}
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, _ = d.Get(1001)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	fmt.Println(results, atomic.LoadInt32(&queries))
+
+	// the key is not cached if it's always changed while loading.
+	hook = func() { t.Create("", []byte(`{"StudentId": 1002, "Subject": "英语", "Score": 85}`)) }
+	fmt.Println(d.Get(1002))
+	fmt.Println(m, len(d.lazy.entries))
+
+	// Output:
+	// <nil>
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE student_id = 1001
+	// [[{1001 语文 90}] [{1001 语文 90}] [{1001 语文 90}]] 1
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE student_id = 1002
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE student_id = 1002
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE student_id = 1002
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE student_id = 1002
+	// <nil> false Data.Get: keys [1002] are changed while loading for 4 times.
+	// map[1001:[{1001 语文 90}]] 1
+}
+
+func ExampleData_Get() {
+	var m map[int]map[string]int
+	var mutex sync.RWMutex
+	d := &Data{
+		RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId", "Subject"}, Value: "Score",
+	}
+	fmt.Println(d.init(reflect.TypeOf(Score{})))
+	d.save(reflect.ValueOf(Score{StudentId: 1001, Subject: "语文", Score: 90}))
+	fmt.Println(d.Get(1001, "语文"))
+	fmt.Println(d.Get(1001, "数学"))
+	fmt.Println(d.Get(1001))
+	fmt.Println(d.Get("1001", "数学"))
+	fmt.Println(d.Get(int8(1), 65))
+	fmt.Println(d.Get(uint(1001), "数学"))
+	// Output:
+	// <nil>
+	// 90 true <nil>
+	// <nil> false <nil>
+	// <nil> false Data.Get: expect 2 keys, got 1.
+	// <nil> false Data.Get: keys[0]: 1001 is not convertible to int.
+	// <nil> false Data.Get: keys[1]: 65 is not convertible to string.
+	// <nil> false Data.Get: keys[0]: 1001 is not convertible to int.
+}
@@ -0,0 +1,279 @@
+package pgcache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/lovego/bsql"
+)
+
+// the state of "Data.SortedSetLimit".
+type sortedSetLimit struct {
+	// the sorted sets which have dropped values, by the array of map keys.
+	truncated map[interface{}]bool
+	// the truncated sets which have lost values, they're refilled at the end of the change.
+	pending map[interface{}][]reflect.Value
+	// the primary keys of the rows of each sorted set, including the dropped ones, by the array of
+	// map keys. It's used to refill a set from "RowStore" if it's true.
+	members map[interface{}]map[interface{}]bool
+	// sql to load the rows of a sorted set, it's used if "RowStore" is false.
+	loadSql string
+	// the pending sets being queried from database out of the lock, true if changed meanwhile.
+	refilling map[interface{}]bool
+}
+
+func (d *Data) checkSortedSetLimit() error {
+	d.limit = nil
+	if d.SortedSetLimit == 0 {
+		return nil
+	}
+	if d.SortedSetLimit < 0 {
+		return errors.New("Data.SortedSetLimit should not be negative.")
+	}
+	if !d.isSortedSets {
+		return errors.New("Data.SortedSetLimit should be zero, if the value is not a sorted set.")
+	}
+	d.limit = &sortedSetLimit{
+		truncated: make(map[interface{}]bool), pending: make(map[interface{}][]reflect.Value),
+		refilling: make(map[interface{}]bool),
+	}
+	return nil
+}
+
+// initLimit prepares to refill a sorted set, from the rows of its members in "RowStore" if it's
+// true, or by the sql to query database.
+func (d *Data) initLimit(t *Table) error {
+	if d.limit == nil {
+		return nil
+	}
+	if t.Lazy != nil {
+		return errors.New("Data.SortedSetLimit is not supported for a lazy table.")
+	}
+	if t.RowStore {
+		d.limit.members = make(map[interface{}]map[interface{}]bool)
+		return nil
+	}
+	var conds []string
+	for i, g := range d.keyGetters {
+		// the rows are queried by the columns.
+		if !g.isField {
+			return fmt.Errorf(
+				"Data.MapKeys[%d]: %s, should be a field to refill a sorted set, unless RowStore is true.",
+				i, d.MapKeys[i],
+			)
+		}
+		column := quoteColumn(t.column(d.MapKeys[i]).name)
+		if d.fanOut != nil && d.fanOut[i] {
+			conds = append(conds, "%s = ANY("+column+")")
+		} else {
+			conds = append(conds, column+" = %s")
+		}
+	}
+	d.limit.loadSql = fmt.Sprintf("SELECT * FROM (%s) AS t", t.LoadSql)
+	if len(conds) > 0 {
+		d.limit.loadSql += " WHERE " + strings.Join(conds, " AND ")
+	}
+	return nil
+}
+
+// limitSortedSet drops the values beyond "SortedSetLimit", and records the set as truncated.
+func (d *Data) limitSortedSet(keys []reflect.Value, slice reflect.Value) reflect.Value {
+	if d.limit == nil || slice.Len() <= d.SortedSetLimit {
+		return slice
+	}
+	for slice.Len() > d.SortedSetLimit {
+		if d.sortOrder != nil {
+			d.sortOrder.removeValue(mapKeysArray(keys), slice.Index(slice.Len()-1))
+		}
+		slice = removeAt(slice, slice.Len()-1)
+	}
+	d.limit.truncated[mapKeysArray(keys)] = true
+	return slice
+}
+
+// removedFromSortedSet records the set to refill, if it's truncated. Because the dropped values
+// may come before a value saved later, the set is refilled even if it's full again.
+func (d *Data) removedFromSortedSet(keys []reflect.Value) {
+	if d.limit == nil {
+		return
+	}
+	if key := mapKeysArray(keys); d.limit.truncated[key] {
+		d.limit.pending[key] = keys
+	}
+}
+
+// changedSortedSet marks the set as changed, if it's being queried from database to refill.
+func (d *Data) changedSortedSet(keys []reflect.Value) {
+	if d.limit == nil {
+		return
+	}
+	key := mapKeysArray(keys)
+	if _, ok := d.limit.refilling[key]; ok {
+		d.limit.refilling[key] = true
+	}
+}
+
+// trackMember records the row as a member of the sorted set of the map keys if saved is true, or
+// not if it's false, so the set is refilled from the rows of its members.
+func (d *Data) trackMember(keys []reflect.Value, row reflect.Value, saved bool) {
+	if d.limit == nil || d.limit.members == nil || d.table == nil || d.table.rowStore == nil {
+		return
+	}
+	key, pk := mapKeysArray(keys), d.table.rowStore.key(row)
+	members := d.limit.members[key]
+	if saved {
+		if members == nil {
+			members = make(map[interface{}]bool)
+			d.limit.members[key] = members
+		}
+		members[pk] = true
+	} else if members != nil {
+		if delete(members, pk); len(members) == 0 {
+			delete(d.limit.members, key)
+		}
+	}
+}
+
+// refill saves the rows of the pending sets again from the rows of "RowStore", if it's true. It
+// should be called with the lock held. Otherwise the sets are refilled by refillByQuery.
+func (d *Data) refill() {
+	if d.limit == nil || d.limit.members == nil || len(d.limit.pending) == 0 {
+		return
+	}
+	pending := d.limit.pending
+	d.limit.pending = make(map[interface{}][]reflect.Value)
+	if d.table == nil {
+		return
+	}
+	for key, keys := range pending {
+		d.refillSet(key, d.memberRows(keys))
+	}
+}
+
+// refillByQuery queries the rows of the pending sets from database out of the lock, then saves
+// them with the lock held. If a set is changed while querying, it's queried again. It should be
+// called without the lock held, and does nothing if "RowStore" is true.
+func (d *Data) refillByQuery() {
+	if d.limit == nil || d.limit.members != nil || d.table == nil {
+		return
+	}
+	var retries = make(map[interface{}]int)
+	for {
+		unlock := d.lock()
+		pending := d.limit.pending
+		if len(pending) == 0 {
+			unlock()
+			return
+		}
+		d.limit.pending = make(map[interface{}][]reflect.Value)
+		for key := range pending {
+			d.limit.refilling[key] = false
+		}
+		unlock()
+
+		var results = make(map[interface{}][]reflect.Value, len(pending))
+		for key, keys := range pending {
+			if rows, err := d.queryRows(keys); err != nil {
+				d.table.Error(fmt.Sprintf("Data.SortedSetLimit: refill %v: %v", key, err))
+			} else {
+				results[key] = rows
+			}
+		}
+
+		unlock = d.lock()
+		for key, keys := range pending {
+			changed := d.limit.refilling[key]
+			delete(d.limit.refilling, key)
+			rows, ok := results[key]
+			if !ok {
+				continue
+			}
+			if changed {
+				if retries[key] < lazyLoadRetries {
+					retries[key]++
+					d.limit.pending[key] = keys
+				} else {
+					d.table.Error(fmt.Sprintf(
+						"Data.SortedSetLimit: refill %v: changed while querying for %d times.",
+						key, retries[key]+1,
+					))
+				}
+				continue
+			}
+			d.refillSet(key, rows)
+		}
+		unlock()
+	}
+}
+
+// refillSet saves the rows to the set of the array of map keys again. It should be called with the
+// lock held.
+func (d *Data) refillSet(key interface{}, rows []reflect.Value) {
+	delete(d.limit.truncated, key)
+	for _, row := range rows {
+		d.preprocess(row)
+		if !d.precond(row) {
+			continue
+		}
+		for _, rowKeys := range d.mapKeys(row) {
+			if mapKeysArray(rowKeys) != key {
+				continue
+			}
+			if d.dataV.Kind() == reflect.Slice {
+				d.saveToSlice(row)
+			} else {
+				d.saveToMap(row, rowKeys)
+			}
+		}
+	}
+}
+
+// memberRows returns the rows of the members of the set from "RowStore".
+func (d *Data) memberRows(keys []reflect.Value) []reflect.Value {
+	key := mapKeysArray(keys)
+	var rows []reflect.Value
+	for pk := range d.limit.members[key] {
+		if row, ok := d.table.rowStore.getKey(pk); ok {
+			rows = append(rows, row)
+		} else {
+			// the primary key is changed in place.
+			delete(d.limit.members[key], pk)
+		}
+	}
+	return rows
+}
+
+// queryRows queries the rows of the set from database.
+func (d *Data) queryRows(keys []reflect.Value) ([]reflect.Value, error) {
+	var params = make([]interface{}, len(keys))
+	for i := range keys {
+		params[i] = bsql.V(keys[i].Interface())
+	}
+	var rows = reflect.New(reflect.SliceOf(d.table.rowStruct)).Elem()
+	if err := d.table.dbQuerier.Query(
+		rows.Addr().Interface(), fmt.Sprintf(d.limit.loadSql, params...),
+	); err != nil {
+		return nil, err
+	}
+	var result = make([]reflect.Value, 0, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		if row := rows.Index(i); d.table.prepareRow(row, true) {
+			result = append(result, row)
+		}
+	}
+	return result, nil
+}
+
+func (l *sortedSetLimit) clear() {
+	l.truncated = make(map[interface{}]bool)
+	l.pending = make(map[interface{}][]reflect.Value)
+	// the rows being queried may be older than the rows saved after clear.
+	for key := range l.refilling {
+		l.refilling[key] = true
+	}
+	if l.members != nil {
+		l.members = make(map[interface{}]map[interface{}]bool)
+	}
+}
@@ -0,0 +1,177 @@
+package pgcache
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+func ExampleData_SortedSetLimit() {
+	var mutex sync.RWMutex
+	var top2 map[string][]Score
+	t := &Table{
+		Name: "scores", RowStruct: Score{}, RowStore: true,
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &top2, MapKeys: []string{"Subject"},
+				SortedSetUniqueKey: []string{"StudentId"}, SortBy: []string{"Score DESC"},
+				SortedSetLimit: 2},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+	t.Create("", []byte(`{"StudentId": 1002, "Subject": "语文", "Score": 98}`))
+	t.Create("", []byte(`{"StudentId": 1003, "Subject": "语文", "Score": 92}`))
+	fmt.Println(top2)
+
+	// refilled from RowStore.
+	t.Delete("", []byte(`{"student_id": 1002, "subject": "语文"}`))
+	fmt.Println(top2)
+
+	// falls out of the top 2.
+	t.Update("",
+		[]byte(`{"student_id": 1001, "subject": "语文"}`),
+		[]byte(`{"student_id": 1001, "subject": "语文", "score": 80}`),
+	)
+	fmt.Println(top2)
+
+	// Output:
+	// <nil>
+	// map[语文:[{1002 语文 98} {1001 语文 95}]]
+	// map[语文:[{1001 语文 95} {1003 语文 92}]]
+	// map[语文:[{1003 语文 92} {1000 语文 90}]]
+}
+
+// testLimitQuerier returns the rows as in database.
+type testLimitQuerier struct {
+	rows *[]Score
+	// called after the rows are queried, to change them meanwhile.
+	querying *func()
+}
+
+func (q testLimitQuerier) Query(data interface{}, sql string, args ...interface{}) error {
+	if strings.Contains(sql, "WHERE") {
+		fmt.Println(sql)
+	}
+	if rows, ok := data.(*[]Score); ok {
+		*rows = append([]Score(nil), *q.rows...)
+	}
+	if q.querying != nil && *q.querying != nil {
+		fn := *q.querying
+		*q.querying = nil
+		fn()
+	}
+	return nil
+}
+func (q testLimitQuerier) GetDB() *sql.DB {
+	return nil
+}
+
+func ExampleData_SortedSetLimit_database() {
+	var rows = []Score{
+		{StudentId: 1001, Subject: "语文", Score: 95},
+		{StudentId: 1002, Subject: "语文", Score: 98},
+		{StudentId: 1003, Subject: "语文", Score: 92},
+	}
+	var mutex sync.RWMutex
+	var top2 map[string][]Score
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &top2, MapKeys: []string{"Subject"},
+				SortedSetUniqueKey: []string{"StudentId"}, SortBy: []string{"Score DESC"},
+				SortedSetLimit: 2},
+		},
+	}
+	fmt.Println(t.init("db", testLimitQuerier{rows: &rows}, testLogger))
+	t.Init("")
+	// the truncated sets don't hold every row for Query and Verify.
+	fmt.Println(top2, t.rowsData() == nil)
+
+	rows = rows[:1]
+	t.Delete("", []byte(`{"StudentId": 1002, "Subject": "语文", "Score": 98}`))
+	fmt.Println(top2)
+
+	// not truncated any more.
+	t.Delete("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+	fmt.Println(top2)
+
+	// Output:
+	// <nil>
+	// map[语文:[{1002 语文 98} {1001 语文 95}]] true
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE subject = '语文'
+	// map[语文:[{1001 语文 95}]]
+	// map[]
+}
+
+func ExampleData_SortedSetLimit_changedWhileQuerying() {
+	var rows = []Score{
+		{StudentId: 1001, Subject: "语文", Score: 95},
+		{StudentId: 1003, Subject: "语文", Score: 92},
+	}
+	var querying func()
+	var mutex sync.RWMutex
+	var top2 map[string][]Score
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &top2, MapKeys: []string{"Subject"},
+				SortedSetUniqueKey: []string{"StudentId"}, SortBy: []string{"Score DESC"},
+				SortedSetLimit: 1},
+		},
+	}
+	fmt.Println(t.init("db", testLimitQuerier{rows: &rows, querying: &querying}, testLogger))
+	t.Init("")
+	fmt.Println(top2)
+
+	// the lock is not held while querying, so the set is changed meanwhile, and queried again.
+	querying = func() {
+		rows[0].Score = 99
+		t.Update("",
+			[]byte(`{"student_id": 1003, "subject": "语文"}`),
+			[]byte(`{"student_id": 1003, "subject": "语文", "score": 99}`),
+		)
+	}
+	rows = rows[1:]
+	t.Delete("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+	fmt.Println(top2)
+
+	// Output:
+	// <nil>
+	// map[语文:[{1001 语文 95}]]
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE subject = '语文'
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE subject = '语文'
+	// map[语文:[{1003 语文 99}]]
+}
+
+func ExampleData_init_invalidSortedSetLimit() {
+	var mutex sync.RWMutex
+	var m map[string]Score
+	var n map[string][]Score
+	for _, t := range []*Table{
+		{Name: "scores", RowStruct: Score{}, Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"Subject"}, SortedSetLimit: 2},
+		}},
+		{Name: "scores", RowStruct: Score{}, Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &n, MapKeys: []string{"Subject"},
+				SortedSetUniqueKey: []string{"StudentId"}, SortedSetLimit: -1},
+		}},
+		{Name: "scores", RowStruct: Score{}, Lazy: &LazyOptions{}, Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &n, MapKeys: []string{"Subject"},
+				SortedSetUniqueKey: []string{"StudentId"}, SortedSetLimit: 2},
+		}},
+		{Name: "scores", RowStruct: Score{}, Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &n, MapKeys: []string{"Name"},
+				MapKeyFuncs:        map[string]interface{}{"Name": func(s Score) string { return s.Subject }},
+				SortedSetUniqueKey: []string{"StudentId"}, SortedSetLimit: 2},
+		}},
+	} {
+		fmt.Println(t.init("db", testQuerier{}, testLogger))
+	}
+	// Output:
+	// Data.SortedSetLimit should be zero, if the value is not a sorted set.
+	// Data.SortedSetLimit should not be negative.
+	// Data.SortedSetLimit is not supported for a lazy table.
+	// Data.MapKeys[0]: Name, should be a field to refill a sorted set, unless RowStore is true.
+}
@@ -0,0 +1,100 @@
+package pgcache
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type Order struct {
+	Id         int64
+	CustomerId *int64
+	Coupon     sql.NullString
+	Note       *string
+}
+
+func ExampleData_NullKeys() {
+	var mutex sync.RWMutex
+	var byCustomer map[int64][]int64
+	var byCoupon map[string][]int64
+	var notes map[int64]string
+	datas := []*Data{
+		{RWMutex: &mutex, DataPtr: &byCustomer, MapKeys: []string{"CustomerId"}, Value: "Id"},
+		{RWMutex: &mutex, DataPtr: &byCoupon, MapKeys: []string{"Coupon"}, Value: "Id",
+			NullKeys: map[string]interface{}{"Coupon": "-"}},
+		{RWMutex: &mutex, DataPtr: &notes, MapKeys: []string{"Id"}, Value: "Note"},
+	}
+	for _, d := range datas {
+		if err := d.init(reflect.TypeOf(Order{})); err != nil {
+			fmt.Println(err)
+		}
+	}
+	customer, note := int64(7), "gift"
+	rows := reflect.ValueOf([]Order{
+		{Id: 1, CustomerId: &customer, Coupon: sql.NullString{String: "NEW", Valid: true}},
+		{Id: 2, CustomerId: &customer, Note: &note},
+		{Id: 3},
+	})
+	for i := 0; i < rows.Len(); i++ {
+		for _, d := range datas {
+			d.save(rows.Index(i))
+		}
+	}
+	fmt.Println(byCustomer, byCoupon, notes)
+
+	for _, d := range datas {
+		d.remove(rows.Index(1))
+		d.remove(rows.Index(2))
+	}
+	fmt.Println(byCustomer, byCoupon, notes)
+
+	// Output:
+	// map[7:[1 2]] map[-:[2 3] NEW:[1]] map[2:gift]
+	// map[7:[1]] map[NEW:[1]] map[]
+}
+
+func ExampleData_init_invalidNullKeys() {
+	var mutex sync.RWMutex
+	var byCustomer map[int64][]int64
+	var byCoupon map[int64][]int64
+	for _, d := range []*Data{
+		{RWMutex: &mutex, DataPtr: &byCustomer, MapKeys: []string{"CustomerId"}, Value: "Id",
+			NullKeys: map[string]interface{}{"Coupon": 0}},
+		{RWMutex: &mutex, DataPtr: &byCustomer, MapKeys: []string{"Id"}, Value: "Id",
+			NullKeys: map[string]interface{}{"Id": 0}},
+		{RWMutex: &mutex, DataPtr: &byCustomer, MapKeys: []string{"CustomerId"}, Value: "Id",
+			NullKeys: map[string]interface{}{"CustomerId": "none"}},
+		{RWMutex: &mutex, DataPtr: &byCoupon, MapKeys: []string{"Coupon"}, Value: "Id"},
+	} {
+		fmt.Println(d.init(reflect.TypeOf(Order{})))
+	}
+	// Output:
+	// Data.NullKeys: Coupon, is not in Data.MapKeys.
+	// Data.NullKeys: Id, is not a pointer or nullable key.
+	// Data.NullKeys: CustomerId, none is not convertible to int64.
+	// Data.MapKeys[0]: Coupon, type sql.NullString is not assignable to int64.
+}
+
+func ExampleData_NullKeys_query() {
+	var mutex sync.RWMutex
+	var byCustomer, byCustomerOrNone map[int64]map[int64]Order
+	t := &Table{Name: "orders", RowStruct: Order{}, Datas: []*Data{
+		{RWMutex: &mutex, DataPtr: &byCustomer, MapKeys: []string{"CustomerId", "Id"}},
+	}}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	// the rows whose CustomerId is NULL are not held, so Query can't scan the Data.
+	fmt.Println(t.rowsData() == nil)
+
+	t.Datas = append(t.Datas, &Data{
+		RWMutex: &mutex, DataPtr: &byCustomerOrNone, MapKeys: []string{"CustomerId", "Id"},
+		NullKeys: map[string]interface{}{"CustomerId": 0},
+	})
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	fmt.Println(t.rowsData() == t.Datas[1])
+	// Output:
+	// <nil>
+	// true
+	// <nil>
+	// true
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lib/pq"
@@ -21,8 +22,18 @@ type Listener struct {
 	db       *sql.DB // db to create func and triggers
 	listener *pq.Listener
 	logger   Logger
+
+	mutex    sync.RWMutex
 	handlers map[string]Handler
 	inited   map[string]chan struct{}
+
+	// notifications received while a table is initing, they are handled after the init.
+	// A connection loss meanwhile is kept as a connLossExtra notification.
+	pending map[string][]*pq.Notification
+	// tables whose init is done.
+	initDone chan string
+	// limit the number of tables initing concurrently.
+	initSema chan struct{}
 }
 
 type Handler interface {
@@ -33,11 +44,21 @@ type Handler interface {
 	ConnLoss(table string)
 }
 
+// KeyColumnsHandler is an optional interface of Handler. If KeyColumns returns non empty columns,
+// the notifications of UPDATE and DELETE carry only the key columns and the changed columns.
+// It takes effect only when the trigger is created.
+type KeyColumnsHandler interface {
+	KeyColumns(table string) string
+}
+
 type Logger interface {
 	Error(args ...interface{})
 	Errorf(format string, args ...interface{})
 }
 
+// the Extra of a notification which calls ConnLoss after a table's init.
+const connLossExtra = "connloss"
+
 type message struct {
 	Action string
 	Old    json.RawMessage
@@ -59,32 +80,78 @@ func New(dbAddr string, db *sql.DB, logger Logger) (*Listener, error) {
 		logger:   logger,
 		handlers: make(map[string]Handler),
 		inited:   make(map[string]chan struct{}),
+		pending:  make(map[string][]*pq.Notification),
+		initDone: make(chan string),
+		initSema: make(chan struct{}, 4),
 	}
 	l.listener = pq.NewListener(dbAddr, time.Second, time.Minute, l.eventLogger)
 	go l.loop()
 	return l, nil
 }
 
+// SetInitParallelism set the max number of tables to init concurrently, the default is 4.
+// The tables already initing are not limited by the new number.
+func (l *Listener) SetInitParallelism(n int) {
+	if n <= 0 {
+		n = 1
+	}
+	l.mutex.Lock()
+	l.initSema = make(chan struct{}, n)
+	l.mutex.Unlock()
+}
+
 // Listen a table and notify the handler with "columns" when a row is created or updated or deleted.
 // When a row is updated, the handler is notified only if some "columns" or "checkColumns" has changed.
+// It returns after the handler's Init method returns.
 func (l *Listener) Listen(table string, columns, checkColumns string, handler Handler) error {
+	inited, err := l.ListenAsync(table, columns, checkColumns, handler)
+	if err != nil {
+		return err
+	}
+	<-inited
+	return nil
+}
+
+// ListenAsync is the same as Listen, except that it doesn't wait for the handler's Init method.
+// The returned channel is closed after the Init method returns and the notifications received
+// meanwhile are handled.
+func (l *Listener) ListenAsync(
+	table string, columns, checkColumns string, handler Handler,
+) (<-chan struct{}, error) {
 	if strings.IndexByte(table, '.') < 0 {
 		table = "public." + table
 	}
+	l.mutex.Lock()
 	if _, ok := l.handlers[table]; ok {
-		return fmt.Errorf("pglistener: table '%s' is aready listened.", table)
-	}
-	if err := createTrigger(l.db, table, columns, checkColumns); err != nil {
-		return err
+		l.mutex.Unlock()
+		return nil, fmt.Errorf("pglistener: table '%s' is aready listened.", table)
 	}
 	l.handlers[table] = handler
-	l.inited[table] = make(chan struct{})
+	inited := make(chan struct{})
+	l.inited[table] = inited
+	l.mutex.Unlock()
+
+	var keyColumns string
+	if h, ok := handler.(KeyColumnsHandler); ok {
+		keyColumns = h.KeyColumns(table)
+	}
+	if err := createTrigger(l.db, table, columns, checkColumns, keyColumns); err != nil {
+		l.removeHandler(table)
+		return nil, err
+	}
 	if err := l.listener.Listen(l.GetChannel(table)); err != nil {
-		return errs.Trace(err)
+		l.removeHandler(table)
+		return nil, errs.Trace(err)
 	}
 	l.listener.Notify <- &pq.Notification{Channel: l.GetChannel(table), Extra: "init"}
-	<-l.inited[table]
-	return nil
+	return inited, nil
+}
+
+func (l *Listener) removeHandler(table string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.handlers, table)
+	delete(l.inited, table)
 }
 
 func (l *Listener) Unlisten(table string) error {
@@ -94,6 +161,10 @@ func (l *Listener) Unlisten(table string) error {
 	if err := l.listener.Unlisten(l.GetChannel(table)); err != nil {
 		return errs.Trace(err)
 	}
+	// so the table can be listened again.
+	l.mutex.Lock()
+	delete(l.handlers, table)
+	l.mutex.Unlock()
 	return nil
 }
 
@@ -101,6 +172,9 @@ func (l *Listener) UnlistenAll() error {
 	if err := l.listener.UnlistenAll(); err != nil {
 		return errs.Trace(err)
 	}
+	l.mutex.Lock()
+	l.handlers = make(map[string]Handler)
+	l.mutex.Unlock()
 	return nil
 }
 
@@ -109,6 +183,8 @@ func (l *Listener) loop() {
 		select {
 		case notice := <-l.listener.Notify:
 			l.handle(notice)
+		case table := <-l.initDone:
+			l.finishInit(table)
 		case <-time.After(time.Minute):
 			go l.listener.Ping()
 		}
@@ -117,21 +193,44 @@ func (l *Listener) loop() {
 
 func (l *Listener) handle(notice *pq.Notification) {
 	if notice == nil { // connection loss
+		l.mutex.RLock()
+		var handlers = make(map[string]Handler, len(l.handlers))
 		for table, handler := range l.handlers {
+			handlers[table] = handler
+		}
+		l.mutex.RUnlock()
+		for table, handler := range handlers {
+			if _, ok := l.pending[table]; ok {
+				// ConnLoss is called after the init, it reloads the table, so the pending
+				// notifications are dropped.
+				l.pending[table] = []*pq.Notification{
+					{Channel: l.GetChannel(table), Extra: connLossExtra},
+				}
+				continue
+			}
 			handler.ConnLoss(table)
 		}
 		return
 	}
 
 	var table = l.GetTable(notice.Channel)
+	l.mutex.RLock()
 	handler := l.handlers[table]
+	l.mutex.RUnlock()
 	if handler == nil {
 		l.logger.Errorf("unexpected Notification: %+v", notice)
+		return
 	}
 	if notice.Extra == "init" {
-		handler.Init(table)
-		l.inited[table] <- struct{}{}
-		close(l.inited[table])
+		l.startInit(table, handler)
+		return
+	}
+	if pending, ok := l.pending[table]; ok {
+		l.pending[table] = append(pending, notice)
+		return
+	}
+	if notice.Extra == connLossExtra {
+		handler.ConnLoss(table)
 		return
 	}
 
@@ -151,6 +250,33 @@ func (l *Listener) handle(notice *pq.Notification) {
 	}
 }
 
+func (l *Listener) startInit(table string, handler Handler) {
+	l.pending[table] = []*pq.Notification{}
+	l.mutex.RLock()
+	sema := l.initSema
+	l.mutex.RUnlock()
+	go func() {
+		sema <- struct{}{}
+		handler.Init(table)
+		<-sema
+		l.initDone <- table
+	}()
+}
+
+func (l *Listener) finishInit(table string) {
+	pending := l.pending[table]
+	delete(l.pending, table)
+	for _, notice := range pending {
+		l.handle(notice)
+	}
+	l.mutex.RLock()
+	inited := l.inited[table]
+	l.mutex.RUnlock()
+	if inited != nil {
+		close(inited)
+	}
+}
+
 func (l *Listener) GetChannel(table string) string {
 	return "pgnotify_" + table
 }
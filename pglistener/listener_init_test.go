@@ -0,0 +1,62 @@
+package pglistener
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lib/pq"
+	loggerPkg "github.com/lovego/logger"
+)
+
+type initingHandler struct {
+	init chan struct{}
+}
+
+func (h initingHandler) Init(table string) {
+	<-h.init
+	fmt.Printf("Init %s\n", table)
+}
+
+func (h initingHandler) Create(table string, content []byte) {
+	fmt.Printf("Create %s %s\n", table, content)
+}
+
+func (h initingHandler) Update(table string, oldContent, newContent []byte) {
+	fmt.Printf("Update %s %s %s\n", table, oldContent, newContent)
+}
+
+func (h initingHandler) Delete(table string, content []byte) {
+	fmt.Printf("Delete %s %s\n", table, content)
+}
+
+func (h initingHandler) ConnLoss(table string) {
+	fmt.Printf("ConnLoss %s\n", table)
+}
+
+func ExampleListener_connLossWhileIniting() {
+	l := &Listener{
+		logger:   loggerPkg.New(os.Stderr),
+		handlers: make(map[string]Handler),
+		inited:   make(map[string]chan struct{}),
+		pending:  make(map[string][]*pq.Notification),
+		initDone: make(chan string),
+		initSema: make(chan struct{}, 4),
+	}
+	l.SetInitParallelism(2)
+	handler := initingHandler{init: make(chan struct{})}
+	l.handlers["public.students"] = handler
+	channel := l.GetChannel("public.students")
+
+	l.handle(&pq.Notification{Channel: channel, Extra: "init"})
+	l.handle(&pq.Notification{Channel: channel, Extra: `{"action": "INSERT", "new": {"id": 1}}`})
+	l.handle(nil)
+	l.handle(&pq.Notification{Channel: channel, Extra: `{"action": "DELETE", "old": {"id": 2}}`})
+	fmt.Println("initing")
+	close(handler.init)
+	l.finishInit(<-l.initDone)
+	// Output:
+	// initing
+	// Init public.students
+	// ConnLoss public.students
+	// Delete public.students {"id": 2}
+}
@@ -1,6 +1,7 @@
 package pglistener
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
@@ -15,11 +16,13 @@ func createPGFunction(db *sql.DB) error {
 	defer cancel()
 	// tg_argv[0] 是需要通知的字段列表
 	// tg_argv[1] 是需要检查是否有变动的字段列表，仅在更新时使用
+	// tg_argv[2] 是可选的主键字段列表，存在时更新和删除仅通知主键和有变动的字段
 	_, err := db.ExecContext(ctx, `
     create or replace function pgnotify() returns trigger as $$
     declare
       old_record record;
       new_record record;
+      key_record record;
       data jsonb;
     begin
       if tg_op = 'UPDATE' then
@@ -38,10 +41,25 @@ func createPGFunction(db *sql.DB) error {
       when 'UPDATE' then
         execute 'select ' || tg_argv[0] into old_record using old;
         execute 'select ' || tg_argv[0] into new_record using new;
-        data := jsonb_set(data, array['old'], to_jsonb(old_record));
-        data := jsonb_set(data, array['new'], to_jsonb(new_record));
+        if tg_nargs > 2 then
+          execute 'select ' || tg_argv[2] into key_record using old;
+          data := jsonb_set(data, array['old'], to_jsonb(key_record));
+          execute 'select ' || tg_argv[2] into key_record using new;
+          data := jsonb_set(data, array['new'], to_jsonb(key_record) || (
+            select coalesce(jsonb_object_agg(n.key, n.value), '{}'::jsonb)
+            from jsonb_each(to_jsonb(new_record)) n
+            where to_jsonb(old_record) -> n.key is distinct from n.value
+          ));
+        else
+          data := jsonb_set(data, array['old'], to_jsonb(old_record));
+          data := jsonb_set(data, array['new'], to_jsonb(new_record));
+        end if;
       when 'DELETE' then
-        execute 'select ' || tg_argv[0] into old_record using old;
+        if tg_nargs > 2 then
+          execute 'select ' || tg_argv[2] into old_record using old;
+        else
+          execute 'select ' || tg_argv[0] into old_record using old;
+        end if;
         data := jsonb_set(data, array['old'], to_jsonb(old_record));
       end case;
 
@@ -55,43 +73,99 @@ func createPGFunction(db *sql.DB) error {
 	return nil
 }
 
-func createTrigger(db *sql.DB, table string, columns, checkColumns string) error {
-	if ok, err := hasExistingTrigger(db, table); err != nil {
+// createTrigger creates the trigger of the table. If the trigger exists with other arguments, such
+// as the key columns left by another handler, it's recreated, so the notifications always carry
+// the columns the handler expects.
+func createTrigger(db *sql.DB, table string, columns, checkColumns, keyColumns string) error {
+	args := triggerArgs(columns, checkColumns, keyColumns)
+	if existing, ok, err := existingTriggerArgs(db, table); err != nil {
 		return err
-	} else if ok {
+	} else if ok && equalArgs(existing, args) {
 		return nil
 	}
 
-	columns = dollarPrefix(columns)
-	if checkColumns != "" {
-		checkColumns = "," + dollarPrefix(checkColumns)
+	var quoted []string
+	for _, arg := range args {
+		quoted = append(quoted, quote(arg))
 	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	if _, err := db.ExecContext(ctx, fmt.Sprintf(
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errs.Trace(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+		"DROP TRIGGER IF EXISTS pgnotify ON %s", table,
+	)); err != nil {
+		return errs.Trace(err)
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(
 		`CREATE TRIGGER pgnotify AFTER INSERT OR UPDATE OR DELETE ON %s
-    FOR EACH ROW EXECUTE PROCEDURE pgnotify(%s, %s)`,
-		table, quote(columns), quote(checkColumns)),
+    FOR EACH ROW EXECUTE PROCEDURE pgnotify(%s)`,
+		table, strings.Join(quoted, ", ")),
 	); err != nil {
 		return errs.Trace(err)
 	}
-	return nil
+	return errs.Trace(tx.Commit())
+}
+
+func triggerArgs(columns, checkColumns, keyColumns string) []string {
+	columns = dollarPrefix(columns)
+	if checkColumns != "" {
+		checkColumns = "," + dollarPrefix(checkColumns)
+	}
+	args := []string{columns, checkColumns}
+	if keyColumns != "" {
+		args = append(args, dollarPrefix(keyColumns))
+	}
+	return args
 }
 
-func hasExistingTrigger(db *sql.DB, table string) (bool, error) {
+// existingTriggerArgs returns the arguments of the existing trigger of the table.
+func existingTriggerArgs(db *sql.DB, table string) ([]string, bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	row := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(*) AS count FROM pg_trigger
+	row := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT tgargs FROM pg_trigger
 WHERE NOT tgisinternal AND tgname = 'pgnotify' AND tgrelid='%s'::regclass
 `, table))
-	var count int
-	if err := row.Scan(&count); err != nil {
-		return false, errs.Trace(err)
+	var args []byte
+	if err := row.Scan(&args); err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, errs.Trace(err)
 	}
+	return parseTriggerArgs(args), true, nil
+}
 
-	return count > 0, nil
+// parseTriggerArgs parses "pg_trigger.tgargs", in which each argument ends with a zero byte.
+func parseTriggerArgs(b []byte) []string {
+	var args []string
+	for len(b) > 0 {
+		end := bytes.IndexByte(b, 0)
+		if end < 0 {
+			end = len(b)
+		}
+		args = append(args, string(b[:end]))
+		if end < len(b) {
+			end++
+		}
+		b = b[end:]
+	}
+	return args
+}
+
+func equalArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func dropExistingTrigger(db *sql.DB, table string) error {
@@ -0,0 +1,17 @@
+package pglistener
+
+import (
+	"fmt"
+)
+
+func Example_triggerArgs() {
+	args := triggerArgs("id,name", "", "id")
+	fmt.Printf("%q\n", args)
+	existing := parseTriggerArgs([]byte("$1.id,$1.name\x00\x00"))
+	fmt.Printf("%q %v\n", existing, equalArgs(existing, args))
+	fmt.Println(equalArgs(existing, triggerArgs("id,name", "", "")))
+	// Output:
+	// ["$1.id,$1.name" "" "$1.id"]
+	// ["$1.id,$1.name" ""] false
+	// true
+}
@@ -0,0 +1,194 @@
+package pgcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/lovego/bsql/scan"
+)
+
+// decodePlan decodes the "to_jsonb" content of a row. It's compiled once by "Table.init", so the
+// content is decoded straight into the row without a map or any field lookup by name.
+type decodePlan struct {
+	rowStruct reflect.Type
+	pgTypes   map[string]string
+	// the fields by the column name, the name in "Columns" and the field name.
+	fields map[string]*planField
+	// the names of the fields which have columns, the fields excluded by `pgcache:"-"` or
+	// `db:"-"` are not decoded.
+	columnFields map[string]bool
+	// the fields of the other keys, found the same way as "scan.Column2Field". A nil value means
+	// the key has no field.
+	others sync.Map
+}
+
+type planField struct {
+	index   []int
+	decoder Decoder
+}
+
+func newDecodePlan(
+	rowStruct reflect.Type, columns []rowColumn, pgTypes map[string]string,
+) *decodePlan {
+	p := &decodePlan{
+		rowStruct: rowStruct, pgTypes: pgTypes, fields: make(map[string]*planField),
+		columnFields: make(map[string]bool),
+	}
+	for _, c := range columns {
+		p.columnFields[c.field.Name] = true
+		// the field may be ambiguous or unexported.
+		field, ok := rowStruct.FieldByName(c.field.Name)
+		if !ok || field.PkgPath != "" {
+			continue
+		}
+		f := &planField{index: field.Index, decoder: columnDecoder(pgTypes[c.column], field.Type)}
+		p.fields[c.column], p.fields[c.name] = f, f
+		if scan.Column2Field(field.Name) == field.Name {
+			p.fields[field.Name] = f
+		}
+	}
+	return p
+}
+
+func (p *decodePlan) field(key []byte) *planField {
+	if f, ok := p.fields[string(key)]; ok {
+		return f
+	}
+	if f, ok := p.others.Load(string(key)); ok {
+		return f.(*planField)
+	}
+	var f *planField
+	field, ok := p.rowStruct.FieldByName(scan.Column2Field(string(key)))
+	if ok && field.PkgPath == "" && p.columnFields[field.Name] {
+		f = &planField{
+			index: field.Index, decoder: columnDecoder(p.pgTypes[string(key)], field.Type),
+		}
+	}
+	p.others.Store(string(key), f)
+	return f
+}
+
+// decode walks the top level object of the content, and decodes each value into its field.
+func (p *decodePlan) decode(content []byte, row reflect.Value) error {
+	i := skipJSONSpace(content, 0)
+	if i >= len(content) || content[i] != '{' {
+		return jsonSyntaxError(content, i)
+	}
+	if i = skipJSONSpace(content, i+1); i < len(content) && content[i] == '}' {
+		return nil
+	}
+	for {
+		if i >= len(content) || content[i] != '"' {
+			return jsonSyntaxError(content, i)
+		}
+		end, err := jsonValueEnd(content, i)
+		if err != nil {
+			return err
+		}
+		key := content[i+1 : end-1]
+		if bytes.IndexByte(key, '\\') >= 0 {
+			var s string
+			if err := json.Unmarshal(content[i:end], &s); err != nil {
+				return err
+			}
+			key = []byte(s)
+		}
+		if i = skipJSONSpace(content, end); i >= len(content) || content[i] != ':' {
+			return jsonSyntaxError(content, i)
+		}
+		i = skipJSONSpace(content, i+1)
+		if end, err = jsonValueEnd(content, i); err != nil {
+			return err
+		}
+		if f := p.field(key); f != nil {
+			field := row.FieldByIndex(f.index)
+			if raw := content[i:end]; bytes.Equal(raw, jsonNull) {
+				field.Set(reflect.Zero(field.Type()))
+			} else if err := f.decoder(field, raw); err != nil {
+				return fmt.Errorf("column %s: %v", key, err)
+			}
+		}
+
+		if i = skipJSONSpace(content, end); i < len(content) && content[i] == ',' {
+			i = skipJSONSpace(content, i+1)
+			continue
+		}
+		if i < len(content) && content[i] == '}' {
+			return nil
+		}
+		return jsonSyntaxError(content, i)
+	}
+}
+
+func skipJSONSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// jsonValueEnd returns the end of the JSON value starting at i. Only the structure is checked,
+// the value itself is checked by its decoder.
+func jsonValueEnd(data []byte, i int) (int, error) {
+	if i >= len(data) {
+		return 0, jsonSyntaxError(data, i)
+	}
+	switch data[i] {
+	case '"':
+		for j := i + 1; j < len(data); j++ {
+			switch data[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1, nil
+			}
+		}
+		return 0, jsonSyntaxError(data, len(data))
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(data); j++ {
+			switch data[j] {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return j + 1, nil
+				}
+			case '"':
+				end, err := jsonValueEnd(data, j)
+				if err != nil {
+					return 0, err
+				}
+				j = end - 1
+			}
+		}
+		return 0, jsonSyntaxError(data, len(data))
+	default:
+		j := i
+		for j < len(data) && !isJSONDelimiter(data[j]) {
+			j++
+		}
+		if j == i {
+			return 0, jsonSyntaxError(data, i)
+		}
+		return j, nil
+	}
+}
+
+func isJSONDelimiter(c byte) bool {
+	switch c {
+	case ',', '}', ']', ' ', '\t', '\n', '\r':
+		return true
+	}
+	return false
+}
+
+func jsonSyntaxError(data []byte, i int) error {
+	if i >= len(data) {
+		return fmt.Errorf("invalid row content: unexpected end: %s", data)
+	}
+	return fmt.Errorf("invalid row content: unexpected %q at offset %d: %s", data[i], i, data)
+}
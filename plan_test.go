@@ -0,0 +1,117 @@
+package pgcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lovego/bsql/scan"
+)
+
+type testStudent struct {
+	Id        int64
+	Name      string
+	Class     string
+	UpdatedAt time.Time
+}
+
+func testDecodePlan(rowStruct interface{}) *decodePlan {
+	typ := reflect.TypeOf(rowStruct)
+	columns, err := rowColumns(typ)
+	if err != nil {
+		panic(err)
+	}
+	return newDecodePlan(typ, columns, nil)
+}
+
+func Example_decodePlan() {
+	plan := testDecodePlan(testStudent{})
+	var student testStudent
+	row := reflect.ValueOf(&student).Elem()
+	fmt.Println(plan.decode([]byte(`{
+		"id": 1, "Name": "Lily", "class": "初三2班", "unknown": {"a": [1, "]"]},
+		"updated_at": null
+	}`), row))
+	fmt.Printf("%+v\n", student)
+
+	student.Name = "Old"
+	fmt.Println(plan.decode([]byte(` { "name" : null } `), row), student.Name == "")
+	fmt.Println(plan.decode([]byte(`{"id": 1 "name": "Lily"}`), row))
+	fmt.Println(plan.decode([]byte(`{"id": 1, "name": "Lily"`), row))
+	fmt.Println(plan.decode([]byte(`{"id": "x"}`), row))
+	// Output:
+	// <nil>
+	// {Id:1 Name:Lily Class:初三2班 UpdatedAt:0001-01-01 00:00:00 +0000 UTC}
+	// <nil> true
+	// invalid row content: unexpected '"' at offset 9: {"id": 1 "name": "Lily"}
+	// invalid row content: unexpected end: {"id": 1, "name": "Lily"
+	// column id: json: cannot unmarshal string into Go value of type int64
+}
+
+func Example_decodePlan_excluded() {
+	type row struct {
+		Id     int64
+		Secret string `pgcache:"-"`
+		Note   string `db:"-"`
+	}
+	plan := testDecodePlan(row{})
+	var r row
+	fmt.Println(plan.decode([]byte(`{"id": 1, "secret": "x", "note": "y"}`), reflect.ValueOf(&r).Elem()))
+	fmt.Printf("%+v\n", r)
+	f, _ := plan.others.Load("secret")
+	fmt.Println(f.(*planField) == nil)
+
+	// Output:
+	// <nil>
+	// {Id:1 Secret: Note:}
+	// true
+}
+
+var benchStudentContent = []byte(`{
+	"id": 1, "name": "李雷", "class": "初三2班", "updated_at": "2019-10-01T08:00:00+08:00"
+}`)
+
+func BenchmarkDecode_plan(b *testing.B) {
+	plan := testDecodePlan(testStudent{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var student testStudent
+		if err := plan.decode(benchStudentContent, reflect.ValueOf(&student).Elem()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecode_map decodes the content by a map and the fields by name, as it was done before
+// the decode plan.
+func BenchmarkDecode_map(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var student testStudent
+		if err := benchDecodeMap(benchStudentContent, reflect.ValueOf(&student).Elem()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchDecodeMap(content []byte, row reflect.Value) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(content, &m); err != nil {
+		return err
+	}
+	for column, raw := range m {
+		field := row.FieldByName(scan.Column2Field(column))
+		if !field.IsValid() {
+			continue
+		}
+		if string(raw) == "null" {
+			field.Set(reflect.Zero(field.Type()))
+		} else if err := columnDecoder("", field.Type())(field, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
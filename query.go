@@ -0,0 +1,472 @@
+package pgcache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Query queries the cached rows of a table in memory. If filters match the leading "MapKeys" of a
+// map Data whose value is the whole row, the rows are got from the Data by the keys, otherwise all
+// the rows of the table are scanned, from "RowStore" if it's true.
+type Query struct {
+	table   *Table
+	filters []queryFilter
+	orders  []queryOrder
+	offset  int
+	// negative means no limit.
+	limit int
+	err   error
+}
+
+type queryFilter struct {
+	field string
+	op    string
+	index []int
+	// converted to the type of the field, only "in" has multiple values.
+	values []reflect.Value
+}
+
+type queryOrder struct {
+	field string
+	index []int
+	desc  bool
+}
+
+// the Data used by a query, and the keys of each layer used to get rows from the Data.
+// If data is nil, the rows are got from store.
+type queryPlan struct {
+	data  *Data
+	keys  [][]reflect.Value
+	store *rowStore
+}
+
+// Query starts a query over the cached rows.
+func (t *Table) Query() *Query {
+	return &Query{table: t, limit: -1}
+}
+
+// Where adds a filter on a field. The op is one of "=", "!=", "<", "<=", ">", ">=" and "in".
+// For "in", the value should be a slice.
+func (q *Query) Where(field, op string, value interface{}) *Query {
+	if q.err != nil {
+		return q
+	}
+	f, ok := q.table.rowStruct.FieldByName(field)
+	if !ok {
+		q.err = fmt.Errorf("Query.Where: %s, no such field in row struct.", field)
+		return q
+	}
+	switch op {
+	case "=", "!=", "in":
+		if !f.Type.Comparable() {
+			q.err = fmt.Errorf("Query.Where: %s, type %v is not comparable.", field, f.Type)
+			return q
+		}
+	case "<", "<=", ">", ">=":
+		if !isOrderedType(f.Type) {
+			q.err = fmt.Errorf("Query.Where: %s, type %v is not orderable.", field, f.Type)
+			return q
+		}
+	default:
+		q.err = fmt.Errorf(`Query.Where: %s, unknown operator "%s".`, field, op)
+		return q
+	}
+
+	var values []interface{}
+	if op == "in" {
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			q.err = fmt.Errorf(`Query.Where: %s, value of "in" should be a slice.`, field)
+			return q
+		}
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, v.Index(i).Interface())
+		}
+	} else {
+		values = []interface{}{value}
+	}
+	filter := queryFilter{field: field, op: op, index: f.Index}
+	for _, value := range values {
+		v, ok := convertKey(reflect.ValueOf(value), f.Type)
+		if !ok {
+			q.err = fmt.Errorf("Query.Where: %s, %v is not convertible to %v.", field, value, f.Type)
+			return q
+		}
+		filter.values = append(filter.values, v)
+	}
+	q.filters = append(q.filters, filter)
+	return q
+}
+
+// OrderBy adds an order by a field.
+func (q *Query) OrderBy(field string, desc bool) *Query {
+	if q.err != nil {
+		return q
+	}
+	f, ok := q.table.rowStruct.FieldByName(field)
+	if !ok {
+		q.err = fmt.Errorf("Query.OrderBy: %s, no such field in row struct.", field)
+		return q
+	}
+	if !isOrderedType(f.Type) {
+		q.err = fmt.Errorf("Query.OrderBy: %s, type %v is not orderable.", field, f.Type)
+		return q
+	}
+	q.orders = append(q.orders, queryOrder{field: field, index: f.Index, desc: desc})
+	return q
+}
+
+// Offset skips the first n rows.
+func (q *Query) Offset(n int) *Query {
+	q.offset = n
+	return q
+}
+
+// Limit returns at most n rows.
+func (q *Query) Limit(n int) *Query {
+	q.limit = n
+	return q
+}
+
+// Find stores the rows into resultsPtr, which should be a pointer to a slice of row struct, or
+// another struct(or pointer to it) to project the rows into. The fields are projected by name.
+func (q *Query) Find(resultsPtr interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+	resultsV := reflect.ValueOf(resultsPtr)
+	if resultsV.Kind() != reflect.Ptr || resultsV.IsNil() || resultsV.Elem().Kind() != reflect.Slice {
+		return errors.New("Query.Find: resultsPtr should be a non nil pointer to a slice.")
+	}
+	project, err := q.projector(resultsV.Elem().Type().Elem())
+	if err != nil {
+		return err
+	}
+	q.table.datasMutex.RLock()
+	plan, err := q.plan()
+	var planRows []reflect.Value
+	if err == nil {
+		planRows = plan.rows()
+	}
+	q.table.datasMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	var rows []reflect.Value
+	for _, row := range planRows {
+		if q.match(row) {
+			rows = append(rows, row)
+		}
+	}
+	q.sort(rows)
+	if q.offset >= len(rows) {
+		rows = nil
+	} else if q.offset > 0 {
+		rows = rows[q.offset:]
+	}
+	if q.limit >= 0 && q.limit < len(rows) {
+		rows = rows[:q.limit]
+	}
+
+	results := reflect.MakeSlice(resultsV.Elem().Type(), len(rows), len(rows))
+	for i, row := range rows {
+		project(row, results.Index(i))
+	}
+	resultsV.Elem().Set(results)
+	return nil
+}
+
+// Explain describes how the query is performed.
+func (q *Query) Explain() string {
+	if q.err != nil {
+		return "error: " + q.err.Error()
+	}
+	q.table.datasMutex.RLock()
+	defer q.table.datasMutex.RUnlock()
+	plan, err := q.plan()
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	var parts []string
+	if len(plan.keys) > 0 {
+		parts = append(parts, fmt.Sprintf("index %s by %s",
+			plan.data.Key(), strings.Join(plan.data.MapKeys[:len(plan.keys)], ","),
+		))
+	} else if plan.data != nil {
+		parts = append(parts, "scan "+plan.data.Key())
+	} else {
+		parts = append(parts, "scan RowStore")
+	}
+	if len(q.filters) > 0 {
+		var filters []string
+		for _, f := range q.filters {
+			var values []string
+			for _, v := range f.values {
+				values = append(values, fmt.Sprintf("%#v", v.Interface()))
+			}
+			value := strings.Join(values, ",")
+			if f.op == "in" {
+				value = "(" + value + ")"
+			}
+			filters = append(filters, fmt.Sprintf("%s %s %s", f.field, f.op, value))
+		}
+		parts = append(parts, "filter "+strings.Join(filters, " AND "))
+	}
+	if len(q.orders) > 0 {
+		var orders []string
+		for _, o := range q.orders {
+			if o.desc {
+				orders = append(orders, o.field+" DESC")
+			} else {
+				orders = append(orders, o.field)
+			}
+		}
+		parts = append(parts, "order by "+strings.Join(orders, ","))
+	}
+	if q.offset > 0 {
+		parts = append(parts, fmt.Sprintf("offset %d", q.offset))
+	}
+	if q.limit >= 0 {
+		parts = append(parts, fmt.Sprintf("limit %d", q.limit))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// plan chooses the map Data whose leading MapKeys are matched by the most "=" or "in" filters.
+func (q *Query) plan() (queryPlan, error) {
+	if q.table.Lazy != nil {
+		return queryPlan{}, errors.New("Query is not supported for a lazy table.")
+	}
+	var best queryPlan
+	for _, d := range q.table.Datas {
+		if d.dataV.Kind() != reflect.Map || !d.holdsRows() {
+			continue
+		}
+		var keys [][]reflect.Value
+		typ := d.dataV.Type()
+		for i, name := range d.MapKeys {
+			// a computed key can't be matched by the filters of fields.
+			if !d.keyGetters[i].isField {
+				break
+			}
+			layerKeys := q.equalKeys(name, typ.Key())
+			if layerKeys == nil {
+				break
+			}
+			keys = append(keys, layerKeys)
+			typ = typ.Elem()
+		}
+		if best.data == nil || len(keys) > len(best.keys) {
+			best = queryPlan{data: d, keys: keys}
+		}
+	}
+	if len(best.keys) == 0 {
+		if q.table.rowStore != nil {
+			return queryPlan{store: q.table.rowStore}, nil
+		}
+		if data := q.table.rowsData(); data != nil {
+			return queryPlan{data: data}, nil
+		}
+		return queryPlan{}, errors.New("Query: no Data holds every row to scan.")
+	}
+	return best, nil
+}
+
+// equalKeys returns the distinct values of the first "=" or "in" filter on the field.
+func (q *Query) equalKeys(field string, keyType reflect.Type) []reflect.Value {
+	for _, f := range q.filters {
+		if f.field != field || (f.op != "=" && f.op != "in") ||
+			len(f.values) > 0 && !f.values[0].Type().ConvertibleTo(keyType) {
+			continue
+		}
+		var keys = []reflect.Value{}
+		var seen = make(map[interface{}]bool)
+		for _, v := range f.values {
+			if !seen[v.Interface()] {
+				seen[v.Interface()] = true
+				keys = append(keys, v.Convert(keyType))
+			}
+		}
+		return keys
+	}
+	return nil
+}
+
+func (p queryPlan) rows() []reflect.Value {
+	if p.data == nil {
+		return p.store.all()
+	}
+	d := p.data
+	d.RLock()
+	defer d.RUnlock()
+	var rows []reflect.Value
+	var walk func(v reflect.Value, layer int)
+	walk = func(v reflect.Value, layer int) {
+		if layer == len(p.keys) {
+			collectRows(v, &rows)
+			return
+		}
+		if v.IsNil() {
+			return
+		}
+		for _, key := range p.keys[layer] {
+			if child := v.MapIndex(key); child.IsValid() {
+				walk(child, layer+1)
+			}
+		}
+	}
+	walk(d.dataV, 0)
+	return rows
+}
+
+func (q *Query) match(row reflect.Value) bool {
+	for _, f := range q.filters {
+		field := row.FieldByIndex(f.index)
+		switch f.op {
+		case "=":
+			if field.Interface() != f.values[0].Interface() {
+				return false
+			}
+		case "!=":
+			if field.Interface() == f.values[0].Interface() {
+				return false
+			}
+		case "in":
+			found := false
+			for _, v := range f.values {
+				if field.Interface() == v.Interface() {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		default:
+			c := compareIndexKey(normalizeIndexKey(field), normalizeIndexKey(f.values[0]))
+			if f.op == "<" && c >= 0 || f.op == "<=" && c > 0 || f.op == ">" && c <= 0 ||
+				f.op == ">=" && c < 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (q *Query) sort(rows []reflect.Value) {
+	if len(q.orders) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, o := range q.orders {
+			c := compareIndexKey(
+				normalizeIndexKey(rows[i].FieldByIndex(o.index)),
+				normalizeIndexKey(rows[j].FieldByIndex(o.index)),
+			)
+			if c != 0 {
+				return c < 0 != o.desc
+			}
+		}
+		return false
+	})
+}
+
+// projector returns a function to set a row to a result of the type.
+func (q *Query) projector(typ reflect.Type) (func(row, result reflect.Value), error) {
+	isPtr := typ.Kind() == reflect.Ptr
+	if isPtr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Query.Find: %v is not a struct or pointer to struct.", typ)
+	}
+	var set func(row, result reflect.Value)
+	if typ == q.table.rowStruct {
+		set = func(row, result reflect.Value) { result.Set(row) }
+	} else {
+		var from, to [][]int
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if rowField, ok := q.table.rowStruct.FieldByName(field.Name); ok {
+				if !rowField.Type.AssignableTo(field.Type) {
+					return nil, fmt.Errorf(
+						"Query.Find: %s, type %v is not assignable to %v.", field.Name, rowField.Type, field.Type,
+					)
+				}
+				from, to = append(from, rowField.Index), append(to, field.Index)
+			}
+		}
+		if len(from) == 0 {
+			return nil, fmt.Errorf("Query.Find: %v has no field of row struct.", typ)
+		}
+		set = func(row, result reflect.Value) {
+			for i := range from {
+				result.FieldByIndex(to[i]).Set(row.FieldByIndex(from[i]))
+			}
+		}
+	}
+	if !isPtr {
+		return set, nil
+	}
+	return func(row, result reflect.Value) {
+		result.Set(reflect.New(typ))
+		set(row, result.Elem())
+	}, nil
+}
+
+// rowsData returns the first Data which holds every row once, it's used to scan all the rows.
+func (t *Table) rowsData() *Data {
+	for _, d := range t.Datas {
+		if d.holdsRows() {
+			return d
+		}
+	}
+	return nil
+}
+
+// holdsRows reports if the values of the Data are the whole rows, and every row is held once.
+func (d *Data) holdsRows() bool {
+	return d.valueGetter == nil && d.dataV.Kind() != reflect.Struct && d.aggregate == nil &&
+		d.sharded == nil && d.fanOut == nil && d.precondMethodIndex < 0 && d.limit == nil &&
+		!d.skipsNullKeys()
+}
+
+// eachRow calls fn with every row cached, the value of the data should be the whole row.
+func (d *Data) eachRow(fn func(row reflect.Value)) {
+	d.RLock()
+	var rows []reflect.Value
+	collectRows(d.dataV, &rows)
+	d.RUnlock()
+	for _, row := range rows {
+		fn(row)
+	}
+}
+
+func collectRows(v reflect.Value, rows *[]reflect.Value) {
+	switch v.Kind() {
+	case reflect.Map:
+		for iter := v.MapRange(); iter.Next(); {
+			collectRows(iter.Value(), rows)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			collectRows(v.Index(i), rows)
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			collectRows(v.Elem(), rows)
+		}
+	case reflect.Struct:
+		// copy the row, so it's safe to use after unlock.
+		row := reflect.New(v.Type()).Elem()
+		row.Set(v)
+		*rows = append(*rows, row)
+	}
+}
@@ -0,0 +1,71 @@
+package pgcache
+
+import (
+	"fmt"
+	"sync"
+)
+
+func ExampleQuery() {
+	var bySubject map[string][]Score
+	var byStudent map[int]map[string]*Score
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &bySubject, MapKeys: []string{"Subject"}, Precond: "Valid",
+				SortedSetUniqueKey: []string{"StudentId"}},
+			{RWMutex: &mutex, DataPtr: &byStudent, MapKeys: []string{"StudentId", "Subject"}},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Clear()
+	t.Save([]Score{
+		{StudentId: 1001, Subject: "语文", Score: 80},
+		{StudentId: 1001, Subject: "数学", Score: 95},
+		{StudentId: 1002, Subject: "语文", Score: 60},
+		{StudentId: 1002, Subject: "数学", Score: -1},
+		{StudentId: 1003, Subject: "语文", Score: 99},
+	})
+
+	var scores []Score
+	q := t.Query().Where("StudentId", "in", []int{1001, 1002}).Where("Score", ">=", 60).
+		OrderBy("Score", true)
+	fmt.Println(q.Explain())
+	fmt.Println(q.Find(&scores), scores)
+
+	q = t.Query().Where("StudentId", "=", 1002).Where("Subject", "=", "数学")
+	fmt.Println(q.Explain())
+	fmt.Println(q.Find(&scores), scores)
+
+	type SubjectScore struct {
+		Subject string
+		Score   int
+	}
+	var projected []*SubjectScore
+	q = t.Query().Where("Subject", "=", "语文").OrderBy("Score", false).Offset(1).Limit(1)
+	fmt.Println(q.Explain())
+	fmt.Println(q.Find(&projected), *projected[0])
+
+	q = t.Query().Where("Score", "!=", 99).OrderBy("StudentId", false).OrderBy("Subject", true)
+	fmt.Println(q.Find(&scores), scores)
+
+	fmt.Println(t.Query().Where("Other", "=", 1).Find(&scores))
+	fmt.Println(t.Query().Where("Score", "~", 1).Explain())
+	fmt.Println(t.Query().Where("Score", "=", "x").Find(&scores))
+	fmt.Println(t.Query().Where("Subject", "=", 65).Find(&scores))
+	fmt.Println(t.Query().Find(&[]int{}))
+	// Output:
+	// <nil>
+	// index map[StudentId:int]map[Subject:string]*pgcache.Score by StudentId; filter StudentId in (1001,1002) AND Score >= 60; order by Score DESC
+	// <nil> [{1001 数学 95} {1001 语文 80} {1002 语文 60}]
+	// index map[StudentId:int]map[Subject:string]*pgcache.Score by StudentId,Subject; filter StudentId = 1002 AND Subject = "数学"
+	// <nil> [{1002 数学 -1}]
+	// scan map[StudentId:int]map[Subject:string]*pgcache.Score; filter Subject = "语文"; order by Score; offset 1; limit 1
+	// <nil> {语文 80}
+	// <nil> [{1001 语文 80} {1001 数学 95} {1002 语文 60} {1002 数学 -1}]
+	// Query.Where: Other, no such field in row struct.
+	// error: Query.Where: Score, unknown operator "~".
+	// Query.Where: Score, x is not convertible to int.
+	// Query.Where: Subject, 65 is not convertible to string.
+	// Query.Find: int is not a struct or pointer to struct.
+}
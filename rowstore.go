@@ -0,0 +1,177 @@
+package pgcache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/lovego/bsql"
+)
+
+// the rows of a table by primary key.
+type rowStore struct {
+	mutex sync.RWMutex
+	// the field index of each primary key field.
+	keyIndexes [][]int
+	// comparable type of an array of primary key fields.
+	keyType reflect.Type
+	rows    map[interface{}]reflect.Value
+	// sql to load a row by primary key, which is not in the store.
+	loadSql string
+}
+
+const primaryKeySql = `SELECT a.attname FROM pg_index i
+JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+WHERE i.indrelid = %s::regclass AND i.indisprimary
+ORDER BY array_position(i.indkey::int2[], a.attnum)`
+
+func (t *Table) initRowStore(dbQuerier DBQuerier) error {
+	if t.Lazy != nil {
+		return errors.New("RowStore is not supported for a lazy table.")
+	}
+	if len(t.PrimaryKey) == 0 {
+		var columns []string
+		if err := dbQuerier.Query(&columns, fmt.Sprintf(primaryKeySql, quote(t.Name))); err != nil {
+			return fmt.Errorf("PrimaryKey: %v", err)
+		}
+		if len(columns) == 0 {
+			return errors.New("PrimaryKey: the table has no primary key.")
+		}
+		fields := t.fieldsByColumn()
+		for _, column := range columns {
+			field, ok := fields[column]
+			if !ok {
+				return fmt.Errorf(`PrimaryKey: column "%s" has no matching field in RowStruct.`, column)
+			}
+			t.PrimaryKey = append(t.PrimaryKey, field.Name)
+		}
+	}
+
+	store := &rowStore{rows: make(map[interface{}]reflect.Value)}
+	var conds []string
+	for i, name := range t.PrimaryKey {
+		field, ok := t.rowStruct.FieldByName(name)
+		if !ok {
+			return fmt.Errorf("PrimaryKey[%d]: %s, no such field in row struct.", i, name)
+		}
+		if !field.Type.Comparable() {
+			return fmt.Errorf("PrimaryKey[%d]: %s, is not comparable.", i, name)
+		}
+		store.keyIndexes = append(store.keyIndexes, field.Index)
+		conds = append(conds, quoteColumn(t.column(name).name)+" = %s")
+	}
+	store.keyType = reflect.ArrayOf(len(t.PrimaryKey), interfaceType)
+	store.loadSql = fmt.Sprintf("SELECT * FROM (%s) AS t WHERE ", t.LoadSql) +
+		strings.Join(conds, " AND ")
+	t.rowStore = store
+	return nil
+}
+
+// KeyColumns implements pglistener.KeyColumnsHandler, so the notifications of UPDATE and DELETE
+// carry only the primary key and the changed columns if "RowStore" is true.
+func (t *Table) KeyColumns(table string) string {
+	if t.rowStore == nil {
+		return ""
+	}
+	var columns []string
+	for _, name := range t.PrimaryKey {
+		columns = append(columns, t.column(name).selectItem())
+	}
+	return strings.Join(columns, ",")
+}
+
+// loadStoredRow saves the row of the content which is not in the store, such as a row rejected by
+// the row hooks before. The content has only the primary key and the changed columns, so the row
+// is loaded by the primary key. It returns an invalid value if the row is not saved.
+func (t *Table) loadStoredRow(content []byte) reflect.Value {
+	keyRow, err := t.decodeRow(content, false)
+	if err != nil {
+		t.Error(err)
+		return reflect.Value{}
+	}
+	var params = make([]interface{}, len(t.rowStore.keyIndexes))
+	for i, index := range t.rowStore.keyIndexes {
+		params[i] = bsql.V(keyRow.FieldByIndex(index).Interface())
+	}
+	var rows = reflect.New(reflect.SliceOf(t.rowStruct)).Elem()
+	if err := t.dbQuerier.Query(
+		rows.Addr().Interface(), fmt.Sprintf(t.rowStore.loadSql, params...),
+	); err != nil {
+		t.Error(fmt.Sprintf("RowStore: load row %s: %v", content, err))
+		return reflect.Value{}
+	}
+	// the row may be deleted since.
+	if rows.Len() == 0 {
+		return reflect.Value{}
+	}
+	row := rows.Index(0)
+	if !t.prepareRow(row, true) {
+		return reflect.Value{}
+	}
+	t.rowStore.save(row)
+	for _, g := range t.groups {
+		g.save(row)
+	}
+	return row
+}
+
+func (s *rowStore) key(row reflect.Value) interface{} {
+	array := reflect.New(s.keyType).Elem()
+	for i, index := range s.keyIndexes {
+		array.Index(i).Set(row.FieldByIndex(index))
+	}
+	return array.Interface()
+}
+
+// get returns a copy of the row which has the same primary key as the row.
+func (s *rowStore) get(row reflect.Value) (reflect.Value, bool) {
+	return s.getKey(s.key(row))
+}
+
+// getKey returns a copy of the row of the primary key.
+func (s *rowStore) getKey(key interface{}) (reflect.Value, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	stored, ok := s.rows[key]
+	if !ok {
+		return reflect.Value{}, false
+	}
+	result := reflect.New(stored.Type()).Elem()
+	result.Set(stored)
+	return result, true
+}
+
+func (s *rowStore) save(row reflect.Value) {
+	stored := reflect.New(row.Type()).Elem()
+	stored.Set(row)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rows[s.key(row)] = stored
+}
+
+func (s *rowStore) remove(row reflect.Value) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.rows, s.key(row))
+}
+
+func (s *rowStore) clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rows = make(map[interface{}]reflect.Value)
+}
+
+// all returns a copy of every row.
+func (s *rowStore) all() []reflect.Value {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var rows = make([]reflect.Value, 0, len(s.rows))
+	for _, stored := range s.rows {
+		row := reflect.New(stored.Type()).Elem()
+		row.Set(stored)
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,112 @@
+package pgcache
+
+import (
+	"fmt"
+	"sync"
+)
+
+func ExampleTable_RowStore() {
+	var m map[string]map[int]Score
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{}, RowStore: true,
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"Subject", "StudentId"}},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	fmt.Println(t.PrimaryKey, t.KeyColumns("public.scores"))
+
+	t.Init("")
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+	fmt.Println(m)
+
+	// only the primary key and the changed columns.
+	t.Update("",
+		[]byte(`{"student_id": 1001, "subject": "语文"}`),
+		[]byte(`{"student_id": 1001, "subject": "数学"}`),
+	)
+	fmt.Println(m)
+	t.Update("",
+		[]byte(`{"student_id": 1000, "subject": "语文"}`),
+		[]byte(`{"student_id": 1000, "subject": "语文", "score": 91}`),
+	)
+	fmt.Println(m)
+
+	t.Delete("", []byte(`{"student_id": 1001, "subject": "数学"}`))
+	fmt.Println(m)
+
+	var scores []Score
+	q := t.Query().Where("Score", ">", 0)
+	fmt.Println(q.Find(&scores), scores, q.Explain())
+
+	// Output:
+	// <nil>
+	// [StudentId Subject] student_id,subject
+	// map[语文:map[1000:{1000 语文 90} 1001:{1001 语文 95}]]
+	// map[数学:map[1001:{1001 数学 95}] 语文:map[1000:{1000 语文 90}]]
+	// map[数学:map[1001:{1001 数学 95}] 语文:map[1000:{1000 语文 91}]]
+	// map[数学:map[] 语文:map[1000:{1000 语文 91}]]
+	// <nil> [{1000 语文 91}] scan RowStore; filter Score > 0
+}
+
+func ExampleTable_initRowStore() {
+	var m map[int]Score
+	var mutex sync.RWMutex
+	for _, t := range []*Table{
+		{Name: "scores", RowStruct: Score{}, RowStore: true, PrimaryKey: []string{"Id"}},
+		{Name: "scores", RowStruct: Score{}, RowStore: true, Lazy: &LazyOptions{}},
+		{Name: "products", RowStruct: Product{}, RowStore: true},
+	} {
+		t.Datas = []*Data{{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}}}
+		if t.Name == "products" {
+			t.Datas[0].MapKeys = []string{"Id"}
+			t.Datas[0].DataPtr = &map[int]Product{}
+		}
+		fmt.Println(t.init("db", testQuerier{}, testLogger))
+	}
+	// Output:
+	// PrimaryKey[0]: Id, no such field in row struct.
+	// RowStore is not supported for a lazy table.
+	// PrimaryKey: column "student_id" has no matching field in RowStruct.
+}
+
+// testLoadRowQuerier loads the row by primary key.
+type testLoadRowQuerier struct {
+	testQuerier
+}
+
+func (q testLoadRowQuerier) Query(data interface{}, sql string, args ...interface{}) error {
+	if rows, ok := data.(*[]HookedScore); ok {
+		fmt.Println(sql)
+		*rows = []HookedScore{{StudentId: 1, Subject: "a", Score: 5}}
+		return nil
+	}
+	return q.testQuerier.Query(data, sql, args...)
+}
+
+func ExampleTable_RowStore_notStored() {
+	var m map[int]HookedScore
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: HookedScore{}, RowStore: true, PrimaryKey: []string{"StudentId"},
+		Datas: []*Data{{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}}},
+	}
+	fmt.Println(t.init("db", testLoadRowQuerier{}, testLogger))
+	// the row is rejected by Validate.
+	t.Create("", []byte(`{"student_id": 1, "subject": "a", "score": -1}`))
+	fmt.Println(m)
+
+	// the row is loaded, instead of saving the partial content.
+	t.Update("", []byte(`{"student_id": 1}`), []byte(`{"student_id": 1, "score": 5}`))
+	fmt.Println(m)
+
+	t.Delete("", []byte(`{"student_id": 2}`))
+	fmt.Println(m)
+	// Output:
+	// <nil>
+	// map[]
+	// SELECT * FROM (SELECT student_id,subject,score  FROM scores) AS t WHERE student_id = 1
+	// map[1:{1 a 5 true}]
+	// map[1:{1 a 5 true}]
+}
@@ -0,0 +1,335 @@
+package pgcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// SearchIndex is a Data container to search values by "Data.SearchFields". It supports prefix
+// lookups of the whole text or any term of the fields, and term search. Its methods can be called
+// after the table is inited, they take the read lock of the Data.
+type SearchIndex struct {
+	// FoldCase makes lookups case insensitive.
+	FoldCase bool
+	// Normalize is optional, it's applied to texts and queries before case folding and tokenizing.
+	// It's usually a Unicode normalization, such as norm.NFKC.String.
+	Normalize func(string) string
+	// Tokenize is optional, it splits a text into terms. If it's nil, a text is splitted by
+	// characters which is not a letter or number.
+	Tokenize func(string) []string
+
+	mutex  *sync.RWMutex
+	fields []string
+	// comparable type of an array of unique key fields.
+	uniqueKeyType reflect.Type
+	docs          map[interface{}]*searchDoc
+	// the whole texts and terms for prefix lookups.
+	root *trieNode
+	// the docs of each term, with the term count of each doc.
+	terms map[string]map[*searchDoc]int
+	// sequence of docs, used to order docs of the same rank.
+	seq uint64
+}
+
+type searchDoc struct {
+	uniqueKey interface{}
+	value     interface{}
+	seq       uint64
+	// the whole texts and terms saved in the trie.
+	keys  []string
+	terms []string
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	// the docs which have this key, with the count of the key of each doc.
+	docs map[*searchDoc]int
+}
+
+var searchIndexType = reflect.TypeOf(SearchIndex{})
+
+func (d *Data) checkSearch(rowStruct reflect.Type) error {
+	if len(d.SearchFields) == 0 {
+		return errors.New("Data.SearchFields is required for a SearchIndex.")
+	}
+	if len(d.MapKeys) > 0 {
+		return errors.New("Data.DataPtr is a SearchIndex, so Data.MapKeys should be empty.")
+	}
+	for i, name := range d.SearchFields {
+		field, ok := rowStruct.FieldByName(name)
+		if !ok {
+			return fmt.Errorf("Data.SearchFields[%d]: %s, no such field in row struct.", i, name)
+		}
+		if field.Type.Kind() != reflect.String {
+			return fmt.Errorf("Data.SearchFields[%d]: %s, should be a string type.", i, name)
+		}
+	}
+	if _, err := d.initValueGetter(rowStruct); err != nil {
+		return err
+	}
+	if len(d.IndexUniqueKey) == 0 {
+		if _, ok := rowStruct.FieldByName("Id"); ok {
+			d.IndexUniqueKey = []string{"Id"}
+		} else {
+			return errors.New("Data.IndexUniqueKey is required.")
+		}
+	}
+	for i, name := range d.IndexUniqueKey {
+		if field, ok := rowStruct.FieldByName(name); !ok {
+			return fmt.Errorf("Data.IndexUniqueKey[%d]: %s, no such field in row struct.", i, name)
+		} else if !field.Type.Comparable() {
+			return fmt.Errorf("Data.IndexUniqueKey[%d]: %s, is not comparable.", i, name)
+		}
+	}
+
+	search := d.dataV.Addr().Interface().(*SearchIndex)
+	search.mutex = d.RWMutex
+	search.fields = d.SearchFields
+	search.uniqueKeyType = reflect.ArrayOf(len(d.IndexUniqueKey), interfaceType)
+	search.clear()
+	d.search = search
+	return nil
+}
+
+// saveToSearch should be called with the lock held.
+func (d *Data) saveToSearch(row reflect.Value) {
+	s := d.search
+	uniqueKey := s.uniqueKey(row, d.IndexUniqueKey)
+	if doc := s.docs[uniqueKey]; doc != nil {
+		s.removeDoc(doc)
+	}
+	s.seq++
+	doc := &searchDoc{uniqueKey: uniqueKey, value: d.getValue(row).Interface(), seq: s.seq}
+	for _, name := range s.fields {
+		text := s.normalize(row.FieldByName(name).String())
+		if text == "" {
+			continue
+		}
+		terms := s.tokenize(text)
+		doc.keys = append(doc.keys, text)
+		doc.keys = append(doc.keys, terms...)
+		doc.terms = append(doc.terms, terms...)
+	}
+	for _, key := range doc.keys {
+		s.root.add(key, doc)
+	}
+	for _, term := range doc.terms {
+		docs := s.terms[term]
+		if docs == nil {
+			docs = make(map[*searchDoc]int)
+			s.terms[term] = docs
+		}
+		docs[doc]++
+	}
+	s.docs[uniqueKey] = doc
+}
+
+// removeFromSearch should be called with the lock held.
+func (d *Data) removeFromSearch(row reflect.Value) {
+	s := d.search
+	if doc := s.docs[s.uniqueKey(row, d.IndexUniqueKey)]; doc != nil {
+		s.removeDoc(doc)
+	}
+}
+
+func (s *SearchIndex) removeDoc(doc *searchDoc) {
+	for _, key := range doc.keys {
+		s.root.remove([]rune(key), doc)
+	}
+	for _, term := range doc.terms {
+		if docs := s.terms[term]; docs != nil {
+			if docs[doc]--; docs[doc] <= 0 {
+				delete(docs, doc)
+			}
+			if len(docs) == 0 {
+				delete(s.terms, term)
+			}
+		}
+	}
+	delete(s.docs, doc.uniqueKey)
+}
+
+func (s *SearchIndex) uniqueKey(row reflect.Value, fields []string) interface{} {
+	array := reflect.New(s.uniqueKeyType).Elem()
+	for i, name := range fields {
+		array.Index(i).Set(row.FieldByName(name))
+	}
+	return array.Interface()
+}
+
+func (s *SearchIndex) normalize(text string) string {
+	if s.Normalize != nil {
+		text = s.Normalize(text)
+	}
+	if s.FoldCase {
+		text = strings.ToLower(text)
+	}
+	return strings.TrimSpace(text)
+}
+
+func (s *SearchIndex) tokenize(text string) []string {
+	if s.Tokenize != nil {
+		return s.Tokenize(text)
+	}
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Len returns the number of values in the index.
+func (s *SearchIndex) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.docs)
+}
+
+// Prefix returns at most limit values, whose whole text or any term of "SearchFields" starts with
+// the prefix. The values matched by shorter texts or terms come first.
+func (s *SearchIndex) Prefix(prefix string, limit int) []interface{} {
+	prefix = s.normalize(prefix)
+	var result []interface{}
+	if prefix == "" || limit <= 0 {
+		return result
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	node := s.root
+	for _, r := range prefix {
+		if node = node.children[r]; node == nil {
+			return result
+		}
+	}
+	var seen = make(map[*searchDoc]bool)
+	// breadth first, so shorter keys come first.
+	for level := []*trieNode{node}; len(level) > 0 && len(result) < limit; {
+		var docs []*searchDoc
+		var next []*trieNode
+		for _, n := range level {
+			for doc := range n.docs {
+				if !seen[doc] {
+					seen[doc] = true
+					docs = append(docs, doc)
+				}
+			}
+			for _, child := range n.children {
+				next = append(next, child)
+			}
+		}
+		sort.Slice(docs, func(i, j int) bool { return docs[i].seq < docs[j].seq })
+		for i := 0; i < len(docs) && len(result) < limit; i++ {
+			result = append(result, docs[i].value)
+		}
+		level = next
+	}
+	return result
+}
+
+// Search returns at most limit values which contain all the terms of the query. The values are
+// ranked by the count of the terms matched.
+func (s *SearchIndex) Search(query string, limit int) []interface{} {
+	terms := s.tokenize(s.normalize(query))
+	var result []interface{}
+	if len(terms) == 0 || limit <= 0 {
+		return result
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var scores map[*searchDoc]int
+	for _, term := range terms {
+		docs := s.terms[term]
+		if len(docs) == 0 {
+			return result
+		}
+		if scores == nil {
+			scores = make(map[*searchDoc]int, len(docs))
+			for doc, count := range docs {
+				scores[doc] = count
+			}
+			continue
+		}
+		for doc := range scores {
+			if count, ok := docs[doc]; ok {
+				scores[doc] += count
+			} else {
+				delete(scores, doc)
+			}
+		}
+	}
+	var docs = make([]*searchDoc, 0, len(scores))
+	for doc := range scores {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if a, b := scores[docs[i]], scores[docs[j]]; a != b {
+			return a > b
+		}
+		return docs[i].seq < docs[j].seq
+	})
+	for i := 0; i < len(docs) && i < limit; i++ {
+		result = append(result, docs[i].value)
+	}
+	return result
+}
+
+// MarshalJSON marshals the values in the order they are saved.
+func (s *SearchIndex) MarshalJSON() ([]byte, error) {
+	var values = []interface{}{}
+	if s.mutex != nil {
+		s.mutex.RLock()
+		var docs = make([]*searchDoc, 0, len(s.docs))
+		for _, doc := range s.docs {
+			docs = append(docs, doc)
+		}
+		s.mutex.RUnlock()
+		sort.Slice(docs, func(i, j int) bool { return docs[i].seq < docs[j].seq })
+		for _, doc := range docs {
+			values = append(values, doc.value)
+		}
+	}
+	return json.Marshal(values)
+}
+
+// clear should be called with the lock held.
+func (s *SearchIndex) clear() {
+	s.docs = make(map[interface{}]*searchDoc)
+	s.root = &trieNode{}
+	s.terms = make(map[string]map[*searchDoc]int)
+}
+
+func (n *trieNode) add(key string, doc *searchDoc) {
+	for _, r := range key {
+		if n.children == nil {
+			n.children = make(map[rune]*trieNode)
+		}
+		child := n.children[r]
+		if child == nil {
+			child = &trieNode{}
+			n.children[r] = child
+		}
+		n = child
+	}
+	if n.docs == nil {
+		n.docs = make(map[*searchDoc]int)
+	}
+	n.docs[doc]++
+}
+
+// remove removes the doc from the key, and returns true if the node becomes empty.
+func (n *trieNode) remove(key []rune, doc *searchDoc) bool {
+	if len(key) == 0 {
+		if n.docs[doc]--; n.docs[doc] <= 0 {
+			delete(n.docs, doc)
+		}
+	} else if child := n.children[key[0]]; child != nil && child.remove(key[1:], doc) {
+		delete(n.children, key[0])
+	}
+	return len(n.docs) == 0 && len(n.children) == 0
+}
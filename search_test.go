@@ -0,0 +1,82 @@
+package pgcache
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+func ExampleSearchIndex() {
+	var search = SearchIndex{FoldCase: true, Normalize: func(s string) string {
+		return strings.Replace(s, "é", "e", -1)
+	}}
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "products", RowStruct: Product{},
+		Datas: []*Data{{
+			RWMutex: &mutex, DataPtr: &search, SearchFields: []string{"Name"}, Value: "Name",
+		}},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Clear()
+	t.Create("", []byte(`{"Id": 1, "Name": "Apple Pie"}`))
+	t.Create("", []byte(`{"Id": 2, "Name": "Pineapple"}`))
+	t.Create("", []byte(`{"Id": 3, "Name": "apple"}`))
+	t.Create("", []byte(`{"Id": 4, "Name": "Café au lait"}`))
+	t.Create("", []byte(`{"Id": 5, "Name": "Apple apple juice"}`))
+
+	fmt.Println(search.Len(), t.Datas[0].Size(), t.Datas[0].Key())
+	fmt.Printf("%q\n", search.Prefix("APP", 10))
+	fmt.Printf("%q\n", search.Prefix("app", 2))
+	fmt.Printf("%q\n", search.Prefix("pi", 10))
+	fmt.Printf("%q\n", search.Prefix("cafe", 10))
+	fmt.Printf("%q\n", search.Search("apple", 10))
+	fmt.Printf("%q\n", search.Search("Apple PIE", 10))
+	fmt.Printf("%q\n", search.Search("orange", 10))
+
+	t.Update("",
+		[]byte(`{"Id": 3, "Name": "apple"}`),
+		[]byte(`{"Id": 3, "Name": "Green Apple"}`),
+	)
+	t.Delete("", []byte(`{"Id": 1, "Name": "Apple Pie"}`))
+	fmt.Println(search.Len())
+	fmt.Printf("%q\n", search.Prefix("app", 10))
+	fmt.Printf("%q\n", search.Prefix("pi", 10))
+	fmt.Printf("%q\n", search.Search("apple", 10))
+
+	t.Clear()
+	fmt.Println(search.Len(), search.Prefix("app", 10))
+	// Output:
+	// <nil>
+	// 5 5 pgcache.SearchIndex[Name]Name
+	// ["Apple Pie" "apple" "Apple apple juice"]
+	// ["Apple Pie" "apple"]
+	// ["Apple Pie" "Pineapple"]
+	// ["Café au lait"]
+	// ["Apple apple juice" "Apple Pie" "apple"]
+	// ["Apple Pie"]
+	// []
+	// 4
+	// ["Apple apple juice" "Green Apple"]
+	// ["Pineapple"]
+	// ["Apple apple juice" "Green Apple"]
+	// 0 []
+}
+
+func ExampleData_init_invalidSearch() {
+	var mutex sync.RWMutex
+	for _, d := range []Data{
+		{RWMutex: &mutex, DataPtr: &SearchIndex{}},
+		{RWMutex: &mutex, DataPtr: &SearchIndex{}, SearchFields: []string{"Other"}},
+		{RWMutex: &mutex, DataPtr: &SearchIndex{}, SearchFields: []string{"Tags"}},
+		{RWMutex: &mutex, DataPtr: &[]Product{}, SearchFields: []string{"Name"}},
+	} {
+		fmt.Println(d.init(reflect.TypeOf(Product{})))
+	}
+	// Output:
+	// Data.SearchFields is required for a SearchIndex.
+	// Data.SearchFields[0]: Other, no such field in row struct.
+	// Data.SearchFields[0]: Tags, should be a string type.
+	// Data.SearchFields should be empty, if Data.DataPtr is not a SearchIndex.
+}
@@ -0,0 +1,297 @@
+package pgcache
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// ShardedMap is a Data container which splits a map into shards by the first map key, each shard
+// has its own lock, so changes and reads of different shards don't block each other. "Data.RWMutex"
+// should be nil for it. Its methods can be called after the table is inited.
+type ShardedMap struct {
+	// Shards is the number of shards, it's 16 if zero.
+	Shards int
+	// Map is a value of the map type of each shard, required. Such as "map[int]Student(nil)".
+	Map interface{}
+
+	shards []*mapShard
+	// the number of map layers.
+	layers int
+}
+
+type mapShard struct {
+	sync.RWMutex
+	// an addressable map value.
+	m reflect.Value
+}
+
+var shardedMapType = reflect.TypeOf(ShardedMap{})
+
+const defaultShards = 16
+
+// checkShardedMap sets dataV to a map of the shard type, so the map of a shard is checked and
+// saved the same as a plain map.
+func (d *Data) checkShardedMap() error {
+	if d.RWMutex != nil {
+		return errors.New("Data.RWMutex should be nil, if Data.DataPtr is a ShardedMap.")
+	}
+	sharded := d.dataV.Addr().Interface().(*ShardedMap)
+	if sharded.Shards < 0 {
+		return fmt.Errorf("ShardedMap.Shards: %d, should not be negative.", sharded.Shards)
+	}
+	if sharded.Shards == 0 {
+		sharded.Shards = defaultShards
+	}
+	mapType := reflect.TypeOf(sharded.Map)
+	if mapType == nil || mapType.Kind() != reflect.Map {
+		return errors.New("ShardedMap.Map should be a map.")
+	}
+	if !stableHash(mapType.Key()) {
+		return fmt.Errorf("ShardedMap.Map: key type %v has no stable hash to shard by.", mapType.Key())
+	}
+	if d.Aggregate != "" {
+		return errors.New("Data.Aggregate is not supported, if Data.DataPtr is a ShardedMap.")
+	}
+	// the shard of a row must not be changed by Preprocess.
+	if d.Preprocess != "" {
+		return errors.New("Data.Preprocess is not supported, if Data.DataPtr is a ShardedMap.")
+	}
+	sharded.shards = make([]*mapShard, sharded.Shards)
+	for i := range sharded.shards {
+		sharded.shards[i] = &mapShard{m: reflect.New(mapType).Elem()}
+		sharded.shards[i].m.Set(reflect.MakeMap(mapType))
+	}
+	sharded.layers = len(d.MapKeys)
+	d.sharded = sharded
+	d.dataV = reflect.New(mapType).Elem()
+	return nil
+}
+
+// lock locks the shards of the rows, or all shards if no rows. It returns the unlock function.
+func (s *ShardedMap) lock(d *Data, rows []reflect.Value) func() {
+	var shards []int
+	if len(rows) == 0 {
+		for i := range s.shards {
+			shards = append(shards, i)
+		}
+	} else {
+		var seen = make(map[int]bool)
+		for _, row := range rows {
+			for _, keys := range d.mapKeys(row) {
+				if i := s.shardIndex(keys[0]); !seen[i] {
+					seen[i] = true
+					shards = append(shards, i)
+				}
+			}
+		}
+		// locked in the same order, so no deadlock.
+		sort.Ints(shards)
+	}
+	for _, i := range shards {
+		s.shards[i].Lock()
+	}
+	return func() {
+		for _, i := range shards {
+			s.shards[i].Unlock()
+		}
+	}
+}
+
+func (s *ShardedMap) shard(key reflect.Value) *mapShard {
+	return s.shards[s.shardIndex(key)]
+}
+
+func (s *ShardedMap) shardIndex(key reflect.Value) int {
+	return int(hashKey(key) % uint64(len(s.shards)))
+}
+
+// clear should be called with all shards locked.
+func (s *ShardedMap) clear() {
+	for _, shard := range s.shards {
+		shard.m.Set(reflect.MakeMap(shard.m.Type()))
+	}
+}
+
+// hashKey hashes a map key, a key converted to an interface type has the same hash as before.
+func hashKey(v reflect.Value) uint64 {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int()) * 0x9E3779B97F4A7C15 >> 32
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() * 0x9E3779B97F4A7C15 >> 32
+	case reflect.String:
+		h := fnv.New64a()
+		h.Write([]byte(v.String()))
+		return h.Sum64()
+	}
+	h := fnv.New64a()
+	writeHashKey(h, v)
+	return h.Sum64()
+}
+
+// writeHashKey writes the bytes of a key of a stable hash type, by the value instead of the
+// representation, so -0 and +0 has the same hash.
+func writeHashKey(h hash.Hash64, v reflect.Value) {
+	var b [8]byte
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		binary.LittleEndian.PutUint64(b[:], uint64(v.Int()))
+		h.Write(b[:])
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		binary.LittleEndian.PutUint64(b[:], v.Uint())
+		h.Write(b[:])
+	case reflect.Float32, reflect.Float64:
+		writeHashFloat(h, v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		writeHashFloat(h, real(v.Complex()))
+		writeHashFloat(h, imag(v.Complex()))
+	case reflect.Bool:
+		if v.Bool() {
+			b[0] = 1
+		}
+		h.Write(b[:1])
+	case reflect.String:
+		// the length separates the strings of an array or struct.
+		binary.LittleEndian.PutUint64(b[:], uint64(v.Len()))
+		h.Write(b[:])
+		h.Write([]byte(v.String()))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			writeHashKey(h, v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			writeHashKey(h, v.Field(i))
+		}
+	}
+}
+
+func writeHashFloat(h hash.Hash64, f float64) {
+	if f == 0 {
+		f = 0 // -0 to +0
+	}
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+	h.Write(b[:])
+}
+
+// stableHash reports if the keys of the type can be hashed by value. Pointers, channels and
+// interfaces are not, because the same key may have different hashes.
+func stableHash(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128,
+		reflect.Bool, reflect.String:
+		return true
+	case reflect.Array:
+		return stableHash(typ.Elem())
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if !stableHash(typ.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Get returns the value of the keys, the number of keys should be 1 to the number of MapKeys.
+// If the keys are less than MapKeys, a copy of the inner map is returned.
+func (s *ShardedMap) Get(keys ...interface{}) (interface{}, bool, error) {
+	if s.shards == nil {
+		return nil, false, errors.New("ShardedMap.Get: the table is not inited.")
+	}
+	if len(keys) == 0 || len(keys) > s.layers {
+		return nil, false, fmt.Errorf("ShardedMap.Get: expect 1 ~ %d keys, got %d.", s.layers, len(keys))
+	}
+	var keyValues = make([]reflect.Value, len(keys))
+	typ := s.shards[0].m.Type()
+	for i, key := range keys {
+		v, ok := convertKey(reflect.ValueOf(key), typ.Key())
+		if !ok {
+			return nil, false, fmt.Errorf(
+				"ShardedMap.Get: keys[%d]: %v is not convertible to %v.", i, key, typ.Key(),
+			)
+		}
+		keyValues[i] = v
+		typ = typ.Elem()
+	}
+
+	shard := s.shard(keyValues[0])
+	shard.RLock()
+	defer shard.RUnlock()
+	value := shard.m
+	for _, key := range keyValues {
+		if value.IsNil() {
+			return nil, false, nil
+		}
+		if value = value.MapIndex(key); !value.IsValid() {
+			return nil, false, nil
+		}
+	}
+	return cloneContainer(value).Interface(), true, nil
+}
+
+// Range calls fn for each key and value of the first layer, until fn returns false. fn is called
+// with the read lock of the shard held, the value should not be modified or kept.
+func (s *ShardedMap) Range(fn func(key, value interface{}) bool) {
+	for _, shard := range s.shards {
+		if !shard.rangeMap(fn) {
+			return
+		}
+	}
+}
+
+func (shard *mapShard) rangeMap(fn func(key, value interface{}) bool) bool {
+	shard.RLock()
+	defer shard.RUnlock()
+	for iter := shard.m.MapRange(); iter.Next(); {
+		if !fn(iter.Key().Interface(), iter.Value().Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// Len returns the number of keys of the first layer.
+func (s *ShardedMap) Len() int {
+	var n int
+	for _, shard := range s.shards {
+		shard.RLock()
+		n += shard.m.Len()
+		shard.RUnlock()
+	}
+	return n
+}
+
+// MarshalJSON marshals the shards as one map.
+func (s *ShardedMap) MarshalJSON() ([]byte, error) {
+	if s.shards == nil {
+		return []byte("{}"), nil
+	}
+	merged := reflect.MakeMap(s.shards[0].m.Type())
+	for _, shard := range s.shards {
+		shard.RLock()
+		for iter := shard.m.MapRange(); iter.Next(); {
+			merged.SetMapIndex(iter.Key(), cloneContainer(iter.Value()))
+		}
+		shard.RUnlock()
+	}
+	return json.Marshal(merged.Interface())
+}
@@ -0,0 +1,121 @@
+package pgcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+func ExampleShardedMap() {
+	var sharded = ShardedMap{Shards: 4, Map: map[string]map[int]int(nil)}
+	var mutex sync.RWMutex
+	var bySubject map[string]map[int]int
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{DataPtr: &sharded, MapKeys: []string{"Subject", "StudentId"}, Value: "Score"},
+			{RWMutex: &mutex, DataPtr: &bySubject, MapKeys: []string{"Subject", "StudentId"}, Value: "Score"},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+	for i, subject := range []string{"数学", "英语", "物理", "化学"} {
+		t.Create("", []byte(fmt.Sprintf(
+			`{"StudentId": 1001, "Subject": "%s", "Score": %d}`, subject, 90+i,
+		)))
+	}
+	t.Update("",
+		[]byte(`{"StudentId": 1001, "Subject": "数学", "Score": 90}`),
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 99}`),
+	)
+	t.Delete("", []byte(`{"StudentId": 1001, "Subject": "化学", "Score": 93}`))
+
+	fmt.Println(sharded.Len(), len(bySubject))
+	fmt.Println(sharded.Get("语文"))
+	fmt.Println(sharded.Get("语文", 1001))
+	fmt.Println(sharded.Get("数学", 1001))
+	fmt.Println(t.Datas[0].Get("英语", 1001))
+	fmt.Println(sharded.Get())
+	fmt.Println(sharded.Get("语文", "1001"))
+
+	var subjects []string
+	sharded.Range(func(key, value interface{}) bool {
+		subjects = append(subjects, key.(string))
+		return true
+	})
+	sort.Strings(subjects)
+	fmt.Println(subjects)
+
+	b, err := json.Marshal(&sharded)
+	fmt.Println(string(b), err)
+	var m map[string]map[int]int
+	fmt.Println(json.Unmarshal(b, &m), reflect.DeepEqual(m, bySubject))
+
+	fmt.Println(t.Datas[0].Key(), t.Datas[0].Size())
+	fmt.Println(t.Datas[0].Data("语文", "1000"))
+
+	t.Clear()
+	fmt.Println(sharded.Len())
+
+	// Output:
+	// <nil>
+	// 5 5
+	// map[1000:90 1001:99] true <nil>
+	// 99 true <nil>
+	// <nil> false <nil>
+	// 91 true <nil>
+	// <nil> false ShardedMap.Get: expect 1 ~ 2 keys, got 0.
+	// <nil> false ShardedMap.Get: keys[1]: 1001 is not convertible to int.
+	// [化学 数学 物理 英语 语文]
+	// {"化学":{},"数学":{},"物理":{"1001":92},"英语":{"1001":91},"语文":{"1000":90,"1001":99}} <nil>
+	// <nil> true
+	// pgcache.ShardedMap[map[Subject:string]map[StudentId:int]Score:int] 5
+	// 90 <nil>
+	// 0
+}
+
+func ExampleData_init_invalidShardedMap() {
+	var mutex sync.RWMutex
+	for _, d := range []*Data{
+		{RWMutex: &mutex, DataPtr: &ShardedMap{Map: map[int]int{}}, MapKeys: []string{"StudentId"}},
+		{DataPtr: &ShardedMap{Shards: -1, Map: map[int]int{}}, MapKeys: []string{"StudentId"}},
+		{DataPtr: &ShardedMap{Map: []int{}}},
+		{DataPtr: &ShardedMap{Map: map[int]int{}}, MapKeys: []string{"StudentId"}, Aggregate: "count"},
+		{DataPtr: &ShardedMap{Map: map[int]int{}}, MapKeys: []string{"StudentId"}, Preprocess: "Other"},
+		{DataPtr: &ShardedMap{Map: map[string]int{}}, MapKeys: []string{"StudentId"}},
+		{DataPtr: &ShardedMap{Map: map[*int]int{}}, MapKeys: []string{"StudentId"}},
+		{DataPtr: &ShardedMap{Map: map[interface{}]int{}}, MapKeys: []string{"StudentId"}},
+	} {
+		fmt.Println(d.init(reflect.TypeOf(Score{})))
+	}
+	// Output:
+	// Data.RWMutex should be nil, if Data.DataPtr is a ShardedMap.
+	// ShardedMap.Shards: -1, should not be negative.
+	// ShardedMap.Map should be a map.
+	// Data.Aggregate is not supported, if Data.DataPtr is a ShardedMap.
+	// Data.Preprocess is not supported, if Data.DataPtr is a ShardedMap.
+	// Data.MapKeys[0]: StudentId, type int is not assignable to string.
+	// ShardedMap.Map: key type *int has no stable hash to shard by.
+	// ShardedMap.Map: key type interface {} has no stable hash to shard by.
+}
+
+func ExampleShardedMap_hashKey() {
+	type key struct {
+		A, B string
+	}
+	negZero := math.Copysign(0, -1)
+	fmt.Println(hashKey(reflect.ValueOf(negZero)) == hashKey(reflect.ValueOf(0.0)))
+	fmt.Println(hashKey(reflect.ValueOf([2]float64{1, negZero})) ==
+		hashKey(reflect.ValueOf([2]float64{1, 0})))
+	fmt.Println(hashKey(reflect.ValueOf(key{"ab", "c"})) == hashKey(reflect.ValueOf(key{"a", "bc"})))
+	fmt.Println(hashKey(reflect.ValueOf(true)) == hashKey(reflect.ValueOf([]interface{}{true}).Index(0)))
+
+	// Output:
+	// true
+	// true
+	// false
+	// true
+}
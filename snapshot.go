@@ -0,0 +1,254 @@
+package pgcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lovego/pgcache/pglistener"
+)
+
+// Journal replays the changes of a table since a watermark to the handler.
+// It's used to catch up a table restored from a snapshot.
+type Journal interface {
+	Replay(table, watermark string, handler pglistener.Handler) error
+}
+
+type snapshotHeader struct {
+	SchemaHash string
+	// the WAL LSN before the rows are loaded.
+	Watermark string
+	Time      time.Time
+	Count     int
+}
+
+const watermarkSql = "SELECT pg_current_wal_lsn()::text"
+
+// restoreSnapshot restores Datas from "SnapshotFile", and catches up the changes since the
+// snapshot is made. It returns false if no snapshot is restored.
+func (t *Table) restoreSnapshot() bool {
+	watermark, restored, err := t.restoreSnapshotRows()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			t.Error("restore snapshot: " + err.Error())
+		}
+		return false
+	}
+	if t.Journal == nil {
+		if err := t.reconcile(restored); err != nil {
+			t.Error(err)
+			if err := t.Reload(false); err != nil {
+				t.Error(err)
+			}
+		}
+		return true
+	}
+	if err := t.Journal.Replay(t.Name, watermark, t); err != nil {
+		t.Error("replay journal: " + err.Error())
+		// the changes may be replayed partly.
+		if err := t.Reload(false); err != nil {
+			t.Error(err)
+		}
+	}
+	return true
+}
+
+// RestoreSnapshot restores Datas from "SnapshotFile", and returns the watermark of the snapshot.
+// The rows are saved to Datas only if the snapshot is made by the same schema.
+func (t *Table) RestoreSnapshot() (string, error) {
+	watermark, _, err := t.restoreSnapshotRows()
+	return watermark, err
+}
+
+// restoreSnapshotRows is the same as RestoreSnapshot, but also returns the rows saved.
+func (t *Table) restoreSnapshotRows() (string, []reflect.Value, error) {
+	file, err := os.Open(t.SnapshotFile)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	decoder := gob.NewDecoder(file)
+	var header snapshotHeader
+	if err := decoder.Decode(&header); err != nil {
+		return "", nil, err
+	}
+	if header.SchemaHash != t.schemaHash() {
+		return "", nil, errors.New("snapshot schema mismatch.")
+	}
+	var rows = reflect.New(reflect.SliceOf(t.rowStruct))
+	if err := decoder.Decode(rows.Interface()); err != nil {
+		return "", nil, err
+	}
+	if rows.Elem().Len() != header.Count {
+		return "", nil, fmt.Errorf("snapshot expect %d rows, got %d.", header.Count, rows.Elem().Len())
+	}
+	t.datasMutex.RLock()
+	t.clear()
+	saved := t.saveRows(rows.Elem())
+	t.publish()
+	t.datasMutex.RUnlock()
+	t.readyOnce.Do(func() { close(t.ready) })
+	return header.Watermark, saved, nil
+}
+
+// reconcile loads the rows from database, and applies the difference from the rows restored to
+// Datas: the restored rows not in database are removed, and the rows not restored are saved.
+func (t *Table) reconcile(restored []reflect.Value) error {
+	start := time.Now()
+	watermark := t.queryWatermark()
+	rows, err := t.loadRows()
+	if err != nil {
+		return fmt.Errorf("reconcile: %v", err)
+	}
+	var counts = make(map[string]int, len(restored))
+	for _, row := range restored {
+		counts[t.rowDigest(row)]++
+	}
+	var fresh []reflect.Value
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Index(i)
+		if !t.prepareRow(row, true) {
+			continue
+		}
+		if digest := t.rowDigest(row); counts[digest] > 0 {
+			counts[digest]--
+		} else {
+			fresh = append(fresh, row)
+		}
+	}
+	var removed int
+	t.datasMutex.RLock()
+	for _, row := range restored {
+		if digest := t.rowDigest(row); counts[digest] > 0 {
+			counts[digest]--
+			t.removeRow(row)
+			removed++
+		}
+	}
+	for _, row := range fresh {
+		t.saveRow(row)
+	}
+	t.publish()
+	t.datasMutex.RUnlock()
+	if err := t.writeSnapshot(rows, watermark); err != nil {
+		t.Error("write snapshot: " + err.Error())
+	}
+	log.Printf("pgcache reconcile removed: %d, saved: %d, fullTime: %6v, \t%s.%s\n", removed,
+		len(fresh), time.Since(start).Round(time.Millisecond), t.dbName, t.Name)
+	t.notify(ChangeReload, reflect.Value{}, reflect.Value{}, nil)
+	return nil
+}
+
+// rowDigest returns the content of the columns of a row to compare. A map is encoded by json, so
+// its keys are sorted.
+func (t *Table) rowDigest(row reflect.Value) string {
+	var digest bytes.Buffer
+	var buf bytes.Buffer
+	for _, c := range t.rowColumns {
+		field := row.FieldByIndex(c.field.Index)
+		buf.Reset()
+		switch {
+		case c.field.PkgPath != "":
+			fmt.Fprintf(&buf, "%#v", field)
+		case field.Kind() == reflect.Ptr && field.IsNil():
+		case field.Kind() == reflect.Map:
+			if b, err := json.Marshal(field.Interface()); err == nil {
+				buf.Write(b)
+			} else {
+				fmt.Fprintf(&buf, "%#v", field.Interface())
+			}
+		default:
+			if err := gob.NewEncoder(&buf).EncodeValue(field); err != nil {
+				buf.Reset()
+				fmt.Fprintf(&buf, "%#v", field.Interface())
+			}
+		}
+		fmt.Fprintf(&digest, "%d:", buf.Len())
+		digest.Write(buf.Bytes())
+	}
+	return digest.String()
+}
+
+// writeSnapshot writes rows to "SnapshotFile" atomically.
+func (t *Table) writeSnapshot(rows reflect.Value, watermark string) error {
+	file, err := ioutil.TempFile(filepath.Dir(t.SnapshotFile), filepath.Base(t.SnapshotFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	encoder := gob.NewEncoder(file)
+	if err := encoder.Encode(snapshotHeader{
+		SchemaHash: t.schemaHash(), Watermark: watermark, Time: time.Now(), Count: rows.Len(),
+	}); err != nil {
+		file.Close()
+		return err
+	}
+	if err := encoder.EncodeValue(rows); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), t.SnapshotFile)
+}
+
+func (t *Table) queryWatermark() string {
+	var watermark string
+	if err := t.dbQuerier.Query(&watermark, watermarkSql); err != nil {
+		t.Error("query watermark: " + err.Error())
+	}
+	return watermark
+}
+
+// schemaHash is the hash of the row struct and the columns, a snapshot is valid only if it's made
+// by the same schemaHash.
+func (t *Table) schemaHash() string {
+	var b strings.Builder
+	b.WriteString(t.Columns + ";" + t.BigColumns + ";")
+	writeTypeSignature(&b, t.rowStruct, map[reflect.Type]bool{})
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeTypeSignature(b *strings.Builder, typ reflect.Type, visited map[reflect.Type]bool) {
+	b.WriteString(typ.String())
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		b.WriteString("<")
+		writeTypeSignature(b, typ.Elem(), visited)
+		b.WriteString(">")
+	case reflect.Map:
+		b.WriteString("<")
+		writeTypeSignature(b, typ.Key(), visited)
+		b.WriteString(",")
+		writeTypeSignature(b, typ.Elem(), visited)
+		b.WriteString(">")
+	case reflect.Struct:
+		if visited[typ] {
+			return
+		}
+		visited[typ] = true
+		b.WriteString("{")
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			b.WriteString(field.Name + " ")
+			writeTypeSignature(b, field.Type, visited)
+			b.WriteString(";")
+		}
+		b.WriteString("}")
+	}
+}
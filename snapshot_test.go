@@ -0,0 +1,195 @@
+package pgcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/lovego/pgcache/pglistener"
+)
+
+type testJournal struct{}
+
+func (j testJournal) Replay(table, watermark string, handler pglistener.Handler) error {
+	fmt.Println("replay", table, "since", watermark)
+	handler.Create(table, []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+	return nil
+}
+
+func ExampleTable_snapshot() {
+	dir, err := ioutil.TempDir("", "pgcache")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "scores.snapshot")
+
+	var m1, m2 map[int]map[string]int
+	var mutex sync.RWMutex
+	t1 := &Table{
+		Name: "scores", RowStruct: Score{}, SnapshotFile: file,
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m1, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	t1.init("db", testQuerier{}, testLogger)
+	t1.Init("")
+	fmt.Println(m1)
+
+	t2 := &Table{
+		Name: "scores", RowStruct: Score{}, SnapshotFile: file, Journal: testJournal{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m2, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	t2.init("db", testQuerier{}, testLogger)
+	t2.Init("")
+	<-t2.Ready()
+	fmt.Println(m2)
+
+	// Output:
+	// map[1000:map[语文:90]]
+	// replay scores since 0/16B3748
+	// map[1000:map[语文:90] 1001:map[语文:95]]
+}
+
+func ExampleTable_RestoreSnapshot_schemaMismatch() {
+	dir, err := ioutil.TempDir("", "pgcache")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "scores.snapshot")
+
+	var m map[int]map[string]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{}, SnapshotFile: file,
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	t.init("db", testQuerier{}, testLogger)
+	_, err = t.RestoreSnapshot()
+	fmt.Println(os.IsNotExist(err))
+	t.Init("")
+
+	type score2 struct {
+		StudentId int
+		Subject   string
+		Score     float64
+	}
+	var m2 map[int]map[string]float64
+	t2 := &Table{
+		Name: "scores", RowStruct: score2{}, SnapshotFile: file,
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m2, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	t2.init("db", testQuerier{}, testLogger)
+	_, err = t2.RestoreSnapshot()
+	fmt.Println(err)
+
+	// Output:
+	// true
+	// snapshot schema mismatch.
+}
+
+// testReconcileQuerier returns the rows changed since the snapshot.
+type testReconcileQuerier struct {
+	testQuerier
+	// the number of queries of rows to fail.
+	fails *int
+}
+
+func (q testReconcileQuerier) Query(data interface{}, sql string, args ...interface{}) error {
+	if rows, ok := data.(*[]Score); ok {
+		if q.fails != nil && *q.fails > 0 {
+			*q.fails--
+			return errors.New("connection refused")
+		}
+		*rows = []Score{
+			{StudentId: 1000, Subject: "数学", Score: 80}, {StudentId: 1001, Subject: "语文", Score: 96},
+		}
+		return nil
+	}
+	return q.testQuerier.Query(data, sql, args...)
+}
+
+func ExampleTable_snapshot_reconcile() {
+	dir, err := ioutil.TempDir("", "pgcache")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "scores.snapshot")
+
+	var m1, m2 map[int]map[string]int
+	var mutex sync.RWMutex
+	t1 := &Table{
+		Name: "scores", RowStruct: Score{}, SnapshotFile: file,
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m1, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	t1.init("db", testQuerier{}, testLogger)
+	// the snapshot has a row deleted since.
+	t1.writeSnapshot(reflect.ValueOf([]Score{
+		{StudentId: 1000, Subject: "语文", Score: 90}, {StudentId: 1000, Subject: "数学", Score: 80},
+	}), "0/16B3748")
+
+	t2 := &Table{
+		Name: "scores", RowStruct: Score{}, SnapshotFile: file,
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m2, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	t2.init("db", testReconcileQuerier{}, testLogger)
+	ch := t2.Watch(context.Background(), nil)
+	t2.Init("")
+	fmt.Println(m2, (<-ch).Type)
+
+	// the table is reloaded if it fails to reconcile.
+	var m3 map[int]map[string]int
+	t3 := &Table{
+		Name: "scores", RowStruct: Score{}, SnapshotFile: file,
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m3, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	t1.writeSnapshot(reflect.ValueOf([]Score{{StudentId: 1000, Subject: "语文", Score: 90}}), "0/16B3748")
+	fails := 1
+	t3.init("db", testReconcileQuerier{fails: &fails}, testLogger)
+	ch = t3.Watch(context.Background(), nil)
+	t3.Init("")
+	fmt.Println(m3, (<-ch).Type)
+
+	// Output:
+	// map[1000:map[数学:80] 1001:map[语文:96]] reload
+	// map[1000:map[数学:80] 1001:map[语文:96]] reload
+}
+
+func ExampleTable_rowDigest() {
+	type Row struct {
+		Id   int               `pgcache:"pk"`
+		Note string            `db:"note" json:"-"`
+		Tags map[string]string `json:"tags"`
+	}
+	t := &Table{Name: "rows", RowStruct: Row{}}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	tags := map[string]string{"a": "1", "b": "2", "c": "3"}
+	digest := t.rowDigest(reflect.ValueOf(Row{Id: 1, Note: "x", Tags: tags}))
+	fmt.Println(digest == t.rowDigest(reflect.ValueOf(Row{Id: 1, Note: "y", Tags: tags})))
+	fmt.Println(digest == t.rowDigest(reflect.ValueOf(Row{Id: 1, Note: "x", Tags: map[string]string{
+		"c": "3", "b": "2", "a": "1",
+	}})))
+	// Output:
+	// <nil>
+	// false
+	// true
+}
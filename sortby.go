@@ -0,0 +1,296 @@
+package pgcache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lovego/sorted_sets"
+)
+
+// sortedSetOrder orders a sorted set by "Data.SortBy" or "Data.SortLess", and then by
+// "Data.SortedSetUniqueKey", so each value has a unique position to binary search.
+type sortedSetOrder struct {
+	// field names, indexes and directions of SortBy.
+	names   []string
+	indexes [][]int
+	desc    []bool
+	// SortLess function.
+	less      reflect.Value
+	uniqueKey []string
+	// field indexes of uniqueKey.
+	uniqueIndexes [][]int
+
+	// the array of the sort fields of each value by unique key, of each sorted set by the array of
+	// map keys, so a value whose sort fields are changed is still found by binary search. It's used
+	// only by "SortBy" with "SortedSetUniqueKey", and has its own mutex, because the sorted sets of a
+	// ShardedMap are guarded by different locks.
+	mutex sync.Mutex
+	sorts map[interface{}]map[interface{}]interface{}
+}
+
+// checkSortBy checks "SortBy" and "SortLess". valueType is the type of "Value", elemType is the
+// element type of the sorted set, which may be a pointer to valueType.
+func (d *Data) checkSortBy(valueType, elemType reflect.Type) error {
+	d.sortOrder = nil
+	if len(d.SortBy) == 0 && d.SortLess == nil {
+		return nil
+	}
+	if !d.isSortedSets {
+		return errors.New("Data.SortBy and Data.SortLess should be empty, if the value is not a sorted set.")
+	}
+	if len(d.SortBy) > 0 && d.SortLess != nil {
+		return errors.New("Data.SortBy and Data.SortLess should not be both set.")
+	}
+	order := &sortedSetOrder{
+		uniqueKey: d.SortedSetUniqueKey, sorts: make(map[interface{}]map[interface{}]interface{}),
+	}
+	structType := valueType
+	for structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() == reflect.Struct {
+		for _, name := range d.SortedSetUniqueKey {
+			field, _ := structType.FieldByName(name)
+			order.uniqueIndexes = append(order.uniqueIndexes, field.Index)
+		}
+	}
+	if d.SortLess != nil {
+		less := reflect.ValueOf(d.SortLess)
+		typ := less.Type()
+		if typ.Kind() != reflect.Func || typ.NumIn() != 2 || typ.NumOut() != 1 ||
+			typ.In(0) != elemType || typ.In(1) != elemType || typ.Out(0).Kind() != reflect.Bool {
+			return fmt.Errorf(`Data.SortLess: should be of "func (a, b %v) bool" form.`, elemType)
+		}
+		order.less = less
+		d.sortOrder = order
+		return nil
+	}
+
+	if valueType = structType; valueType.Kind() != reflect.Struct {
+		return errors.New("Data.SortBy should be empty, if the value is not a struct.")
+	}
+	for i, s := range d.SortBy {
+		parts := strings.Fields(s)
+		if len(parts) == 0 || len(parts) > 2 ||
+			len(parts) == 2 && !strings.EqualFold(parts[1], "ASC") && !strings.EqualFold(parts[1], "DESC") {
+			return fmt.Errorf(`Data.SortBy[%d]: %s, should be of "Field", "Field ASC" or "Field DESC" form.`, i, s)
+		}
+		field, ok := valueType.FieldByName(parts[0])
+		if !ok {
+			return fmt.Errorf("Data.SortBy[%d]: %s, no such field in value struct.", i, parts[0])
+		}
+		if !isOrderedType(field.Type) {
+			return fmt.Errorf("Data.SortBy[%d]: %s, type %v is not orderable.", i, parts[0], field.Type)
+		}
+		order.names = append(order.names, parts[0])
+		order.indexes = append(order.indexes, field.Index)
+		order.desc = append(order.desc, len(parts) == 2 && strings.EqualFold(parts[1], "DESC"))
+	}
+	d.sortOrder = order
+	return nil
+}
+
+// saveToSortedSet saves the value to the sorted set of the map keys and returns the result.
+func (d *Data) saveToSortedSet(keys []reflect.Value, slice, value reflect.Value) reflect.Value {
+	d.changedSortedSet(keys)
+	if d.sortOrder != nil {
+		slice = d.sortOrder.save(mapKeysArray(keys), slice, value)
+	} else {
+		slice = sorted_sets.SaveValue(slice, value, d.SortedSetUniqueKey...)
+	}
+	return d.limitSortedSet(keys, slice)
+}
+
+// removeFromSortedSet removes the value from the sorted set of the map keys and returns the result.
+func (d *Data) removeFromSortedSet(keys []reflect.Value, slice, value reflect.Value) reflect.Value {
+	d.changedSortedSet(keys)
+	n := slice.Len()
+	if d.sortOrder != nil {
+		slice = d.sortOrder.remove(mapKeysArray(keys), slice, value)
+	} else {
+		slice = sorted_sets.RemoveValue(slice, value, d.SortedSetUniqueKey...)
+	}
+	if !slice.IsValid() || slice.Len() < n {
+		d.removedFromSortedSet(keys)
+	}
+	return slice
+}
+
+func (o *sortedSetOrder) compare(a, b reflect.Value) int {
+	if o.less.IsValid() {
+		if o.less.Call([]reflect.Value{a, b})[0].Bool() {
+			return -1
+		}
+		if o.less.Call([]reflect.Value{b, a})[0].Bool() {
+			return 1
+		}
+	} else {
+		x, y := reflect.Indirect(a), reflect.Indirect(b)
+		for i, index := range o.indexes {
+			c := compareIndexKey(
+				normalizeIndexKey(x.FieldByIndex(index)), normalizeIndexKey(y.FieldByIndex(index)),
+			)
+			if c != 0 {
+				if o.desc[i] {
+					return -c
+				}
+				return c
+			}
+		}
+	}
+	return sorted_sets.CompareValue(a, b, o.uniqueKey...)
+}
+
+// search returns the position of the value in the slice, and if it's found.
+func (o *sortedSetOrder) search(slice, value reflect.Value) (int, bool) {
+	n := slice.Len()
+	i := sort.Search(n, func(i int) bool { return o.compare(slice.Index(i), value) >= 0 })
+	return i, i < n && o.compare(slice.Index(i), value) == 0
+}
+
+// save inserts the value by binary search. A value of the same unique key but different sort
+// fields is removed, so the unique key is still unique.
+func (o *sortedSetOrder) save(setKey interface{}, slice, value reflect.Value) reflect.Value {
+	if !slice.IsValid() {
+		o.setValue(setKey, value)
+		return reflect.Append(reflect.MakeSlice(reflect.SliceOf(value.Type()), 0, 1), value)
+	}
+	i, found := o.search(slice, value)
+	if found {
+		slice.Index(i).Set(value)
+		o.setValue(setKey, value)
+		return slice
+	}
+	if j, ok := o.searchUniqueKey(setKey, slice, value); ok {
+		slice = removeAt(slice, j)
+		if j < i {
+			i--
+		}
+	}
+	slice = reflect.Append(slice, value)
+	reflect.Copy(slice.Slice(i+1, slice.Len()), slice.Slice(i, slice.Len()-1))
+	slice.Index(i).Set(value)
+	o.setValue(setKey, value)
+	return slice
+}
+
+// remove removes the value by binary search. If the value is not found by its sort fields, it's
+// removed by its unique key.
+func (o *sortedSetOrder) remove(setKey interface{}, slice, value reflect.Value) reflect.Value {
+	if !slice.IsValid() {
+		return slice
+	}
+	i, found := o.search(slice, value)
+	if !found {
+		i, found = o.searchUniqueKey(setKey, slice, value)
+	}
+	o.removeValue(setKey, value)
+	if found {
+		return removeAt(slice, i)
+	}
+	return slice
+}
+
+// searchUniqueKey returns the position of the value of the same unique key in the slice, by
+// binary search with the sort fields saved before, or by a linear search if they're not saved.
+func (o *sortedSetOrder) searchUniqueKey(setKey interface{}, slice, value reflect.Value) (int, bool) {
+	if !o.savesSorts() {
+		for i := 0; i < slice.Len(); i++ {
+			if sorted_sets.CompareValue(slice.Index(i), value, o.uniqueKey...) == 0 {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	o.mutex.Lock()
+	sorts, ok := o.sorts[setKey][o.uniqueKeyOf(value)]
+	o.mutex.Unlock()
+	if !ok {
+		return 0, false
+	}
+	// a value of the unique key and the saved sort fields to search.
+	target := reflect.New(reflect.Indirect(value).Type())
+	sortsV := reflect.ValueOf(sorts)
+	for i, index := range o.indexes {
+		target.Elem().FieldByIndex(index).Set(sortsV.Index(i).Elem())
+	}
+	for _, index := range o.uniqueIndexes {
+		target.Elem().FieldByIndex(index).Set(reflect.Indirect(value).FieldByIndex(index))
+	}
+	if value.Kind() != reflect.Ptr {
+		target = target.Elem()
+	}
+	return o.search(slice, target)
+}
+
+// savesSorts reports if the sort fields of the values are saved by unique key.
+func (o *sortedSetOrder) savesSorts() bool {
+	return !o.less.IsValid() && len(o.uniqueIndexes) > 0
+}
+
+func (o *sortedSetOrder) uniqueKeyOf(value reflect.Value) interface{} {
+	value = reflect.Indirect(value)
+	var keys = make([]reflect.Value, len(o.uniqueIndexes))
+	for i, index := range o.uniqueIndexes {
+		keys[i] = value.FieldByIndex(index)
+	}
+	return mapKeysArray(keys)
+}
+
+func (o *sortedSetOrder) setValue(setKey interface{}, value reflect.Value) {
+	if !o.savesSorts() {
+		return
+	}
+	struc := reflect.Indirect(value)
+	var fields = make([]reflect.Value, len(o.indexes))
+	for i, index := range o.indexes {
+		fields[i] = struc.FieldByIndex(index)
+	}
+	sorts := mapKeysArray(fields)
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	values := o.sorts[setKey]
+	if values == nil {
+		values = make(map[interface{}]interface{})
+		o.sorts[setKey] = values
+	}
+	values[o.uniqueKeyOf(value)] = sorts
+}
+
+func (o *sortedSetOrder) removeValue(setKey interface{}, value reflect.Value) {
+	if !o.savesSorts() {
+		return
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if values := o.sorts[setKey]; values != nil {
+		if delete(values, o.uniqueKeyOf(value)); len(values) == 0 {
+			delete(o.sorts, setKey)
+		}
+	}
+}
+
+// removeSet forgets the values of a sorted set which is removed as a whole.
+func (o *sortedSetOrder) removeSet(setKey interface{}) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	delete(o.sorts, setKey)
+}
+
+func (o *sortedSetOrder) clear() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.sorts = make(map[interface{}]map[interface{}]interface{})
+}
+
+// removeAt removes the element at i in place, the last element is zeroed to be garbage collected.
+func removeAt(slice reflect.Value, i int) reflect.Value {
+	n := slice.Len()
+	reflect.Copy(slice.Slice(i, n), slice.Slice(i+1, n))
+	slice.Index(n - 1).Set(reflect.Zero(slice.Type().Elem()))
+	return slice.Slice(0, n-1)
+}
@@ -0,0 +1,110 @@
+package pgcache
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+func ExampleData_SortBy() {
+	var mutex sync.RWMutex
+	var bySubject map[string][]Score
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &bySubject, MapKeys: []string{"Subject"},
+				SortedSetUniqueKey: []string{"StudentId"}, SortBy: []string{"Score DESC"}},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Init("")
+	t.Create("", []byte(`{"StudentId": 1003, "Subject": "语文", "Score": 95}`))
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+	t.Create("", []byte(`{"StudentId": 1002, "Subject": "语文", "Score": 98}`))
+	fmt.Println(bySubject)
+
+	t.Update("",
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`),
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 99}`),
+	)
+	fmt.Println(bySubject)
+
+	t.Delete("", []byte(`{"StudentId": 1003, "Subject": "语文", "Score": 95}`))
+	fmt.Println(bySubject)
+
+	// the values of changed or unknown sort fields are found by their unique keys.
+	t.Save([]Score{{StudentId: 1000, Subject: "语文", Score: 97}})
+	fmt.Println(bySubject)
+	t.Delete("", []byte(`{"StudentId": 1002, "Subject": "语文"}`))
+	fmt.Println(bySubject)
+	// only the sort fields are kept by unique key.
+	fmt.Println(t.Datas[0].sortOrder.sorts[[1]interface{}{"语文"}])
+
+	// Output:
+	// <nil>
+	// map[语文:[{1002 语文 98} {1001 语文 95} {1003 语文 95} {1000 语文 90}]]
+	// map[语文:[{1001 语文 99} {1002 语文 98} {1003 语文 95} {1000 语文 90}]]
+	// map[语文:[{1001 语文 99} {1002 语文 98} {1000 语文 90}]]
+	// map[语文:[{1001 语文 99} {1002 语文 98} {1000 语文 97}]]
+	// map[语文:[{1001 语文 99} {1000 语文 97}]]
+	// map[[1000]:[97] [1001]:[99]]
+}
+
+func ExampleData_SortLess() {
+	var mutex sync.RWMutex
+	var s []*Score
+	d := Data{
+		RWMutex: &mutex, DataPtr: &s, SortedSetUniqueKey: []string{"StudentId"},
+		SortLess: func(a, b *Score) bool { return a.Subject < b.Subject },
+	}
+	fmt.Println(d.init(reflect.TypeOf(Score{})))
+	rows := reflect.ValueOf([]Score{
+		{StudentId: 1002, Subject: "语文", Score: 98},
+		{StudentId: 1001, Subject: "数学", Score: 95},
+		{StudentId: 1003, Subject: "数学", Score: 90},
+		// the unique key is still unique.
+		{StudentId: 1002, Subject: "英语", Score: 96},
+	})
+	for i := 0; i < rows.Len(); i++ {
+		d.save(rows.Index(i))
+	}
+	printScores(s)
+
+	d.remove(reflect.ValueOf(Score{StudentId: 1001, Subject: "数学"}))
+	printScores(s)
+
+	// Output:
+	// <nil>
+	// [{1001 数学 95} {1003 数学 90} {1002 英语 96}]
+	// [{1003 数学 90} {1002 英语 96}]
+}
+
+func printScores(scores []*Score) {
+	var values []Score
+	for _, score := range scores {
+		values = append(values, *score)
+	}
+	fmt.Println(values)
+}
+
+func ExampleData_init_invalidSortBy() {
+	var mutex sync.RWMutex
+	var m map[string][]Score
+	var n map[string]Score
+	for _, d := range []*Data{
+		{RWMutex: &mutex, DataPtr: &n, MapKeys: []string{"Subject"}, SortBy: []string{"Score"}},
+		{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"Subject"},
+			SortedSetUniqueKey: []string{"StudentId"}, SortBy: []string{"Score DOWN"}},
+		{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"Subject"},
+			SortedSetUniqueKey: []string{"StudentId"}, SortBy: []string{"Name"}},
+		{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"Subject"},
+			SortedSetUniqueKey: []string{"StudentId"}, SortLess: func(a, b *Score) bool { return true }},
+	} {
+		fmt.Println(d.init(reflect.TypeOf(Score{})))
+	}
+	// Output:
+	// Data.SortBy and Data.SortLess should be empty, if the value is not a sorted set.
+	// Data.SortBy[0]: Score DOWN, should be of "Field", "Field ASC" or "Field DESC" form.
+	// Data.SortBy[0]: Name, no such field in value struct.
+	// Data.SortLess: should be of "func (a, b pgcache.Score) bool" form.
+}
@@ -0,0 +1,193 @@
+package pgcache
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+// ChangeType is the type of a ChangeEvent.
+type ChangeType string
+
+const (
+	ChangeCreate ChangeType = "create"
+	ChangeUpdate ChangeType = "update"
+	ChangeDelete ChangeType = "delete"
+	// The table is reloaded, every row may be changed. "Old" and "New" are nil.
+	ChangeReload ChangeType = "reload"
+)
+
+// ChangeEvent is a change of a table, it's delivered after all Datas are updated.
+type ChangeEvent struct {
+	Table string
+	Type  ChangeType
+	// The old row of "RowStruct" type, nil for "create".
+	Old interface{}
+	// The new row of "RowStruct" type, nil for "delete".
+	New interface{}
+	// The names of the changed top level fields of "RowStruct", only for "update".
+	Changed []string
+}
+
+// OverflowPolicy tells what to do with an event when the buffer of a subscriber is full.
+type OverflowPolicy int
+
+const (
+	// The event is dropped and an error is logged.
+	OverflowDrop OverflowPolicy = iota
+	// The table waits until the subscriber receives the event, so the following changes are
+	// delayed, even of other subscribers.
+	OverflowBlock
+)
+
+type SubscribeOptions struct {
+	// Buffer is the number of events buffered for a subscriber, it's 100 if zero.
+	Buffer int
+	// Overflow is the policy when the buffer is full, it's "OverflowDrop" by default.
+	Overflow OverflowPolicy
+	// Fields is optional. If it's not empty, only the updates which change any of the fields are
+	// delivered, other types of events are always delivered.
+	Fields []string
+}
+
+const defaultSubscribeBuffer = 100
+
+type subscription struct {
+	ch       chan ChangeEvent
+	overflow OverflowPolicy
+	fields   []string
+	// closed when the subscription is canceled.
+	done chan struct{}
+	// senders hold the read lock, and ch is closed with the write lock held.
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// Subscribe calls fn with each change of the table in a separate goroutine, until cancel is called
+// or the table is removed from DB. options can be nil.
+func (t *Table) Subscribe(fn func(ChangeEvent), options *SubscribeOptions) (cancel func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := t.Watch(ctx, options)
+	go func() {
+		for event := range ch {
+			fn(event)
+		}
+	}()
+	return cancel
+}
+
+// Watch returns a channel of the changes of the table, it's closed after ctx is done or the table
+// is removed from DB. options can be nil.
+func (t *Table) Watch(ctx context.Context, options *SubscribeOptions) <-chan ChangeEvent {
+	if options == nil {
+		options = &SubscribeOptions{}
+	}
+	buffer := options.Buffer
+	if buffer <= 0 {
+		buffer = defaultSubscribeBuffer
+	}
+	s := &subscription{
+		ch: make(chan ChangeEvent, buffer), overflow: options.Overflow, fields: options.Fields,
+		done: make(chan struct{}),
+	}
+	t.subscriptionsMutex.Lock()
+	t.subscriptions = append(t.subscriptions[:len(t.subscriptions):len(t.subscriptions)], s)
+	removed := t.removed
+	t.subscriptionsMutex.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-removed:
+		}
+		t.unsubscribe(s)
+	}()
+	return s.ch
+}
+
+func (t *Table) unsubscribe(s *subscription) {
+	t.subscriptionsMutex.Lock()
+	for i := range t.subscriptions {
+		if t.subscriptions[i] == s {
+			subscriptions := make([]*subscription, 0, len(t.subscriptions)-1)
+			t.subscriptions = append(append(subscriptions, t.subscriptions[:i]...),
+				t.subscriptions[i+1:]...)
+			break
+		}
+	}
+	t.subscriptionsMutex.Unlock()
+
+	close(s.done)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	close(s.ch)
+}
+
+// notify delivers a change to the subscribers. An invalid row is nil in the event, and nothing is
+// delivered if both rows are invalid, unless it's a reload.
+func (t *Table) notify(typ ChangeType, oldRow, newRow reflect.Value, changed []bool) {
+	if typ != ChangeReload && !oldRow.IsValid() && !newRow.IsValid() {
+		return
+	}
+	t.subscriptionsMutex.Lock()
+	subscriptions := t.subscriptions
+	t.subscriptionsMutex.Unlock()
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	event := ChangeEvent{Table: t.Name, Type: typ}
+	if oldRow.IsValid() {
+		event.Old = oldRow.Interface()
+	}
+	if newRow.IsValid() {
+		event.New = newRow.Interface()
+	}
+	if changed != nil {
+		event.Changed = changedNames(t.rowStruct, changed)
+	}
+	for _, s := range subscriptions {
+		if changed != nil && !s.interested(t.rowStruct, changed) {
+			continue
+		}
+		if !s.send(event) {
+			t.Error("subscriber buffer is full, event dropped.")
+		}
+	}
+}
+
+// interested reports if any of the fields of the subscription is changed.
+func (s *subscription) interested(rowStruct reflect.Type, changed []bool) bool {
+	if len(s.fields) == 0 {
+		return true
+	}
+	for _, i := range topFieldIndexes(rowStruct, s.fields) {
+		if changed[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// send returns false if the event is dropped because the buffer is full.
+func (s *subscription) send(event ChangeEvent) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		return true
+	}
+	if s.overflow == OverflowBlock {
+		select {
+		case s.ch <- event:
+		case <-s.done:
+		}
+		return true
+	}
+	select {
+	case s.ch <- event:
+		return true
+	default:
+		return false
+	}
+}
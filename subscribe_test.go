@@ -0,0 +1,112 @@
+package pgcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+func ExampleTable_Subscribe() {
+	var m map[int]map[string]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+
+	var wg sync.WaitGroup
+	cancel := t.Subscribe(func(event ChangeEvent) {
+		mutex.RLock()
+		// the Datas are updated before the event is delivered.
+		fmt.Println(event.Table, event.Type, event.Old, event.New, m[1001])
+		mutex.RUnlock()
+		wg.Done()
+	}, &SubscribeOptions{Overflow: OverflowBlock})
+
+	wg.Add(1)
+	t.Init("")
+	wg.Wait()
+	wg.Add(1)
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+	wg.Wait()
+	wg.Add(1)
+	t.Update("",
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`),
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 97}`),
+	)
+	wg.Wait()
+	wg.Add(1)
+	t.Delete("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 97}`))
+	wg.Wait()
+	cancel()
+
+	// Output:
+	// <nil>
+	// scores reload <nil> <nil> map[]
+	// scores create <nil> {1001 语文 95} map[语文:95]
+	// scores update {1001 语文 95} {1001 语文 97} map[语文:97]
+	// scores delete {1001 语文 97} <nil> map[]
+}
+
+func ExampleTable_Watch() {
+	var m map[int]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}, Value: "Score"},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := t.Watch(ctx, &SubscribeOptions{Buffer: 1})
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+	// dropped, the buffer is full.
+	t.Create("", []byte(`{"StudentId": 1002, "Subject": "语文", "Score": 96}`))
+	// not delivered, the content is invalid.
+	t.Create("", []byte(`{"StudentId": "a"}`))
+	event := <-ch
+	fmt.Println(event.Type, event.New.(Score).StudentId, m)
+
+	cancel()
+	for event := range ch {
+		fmt.Println(event)
+	}
+	fmt.Println("closed")
+	t.Create("", []byte(`{"StudentId": 1003, "Subject": "语文", "Score": 97}`))
+
+	// Output:
+	// <nil>
+	// create 1001 map[1001:95 1002:96]
+	// closed
+}
+
+func ExampleTable_Update_undecodable() {
+	var m map[int]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}, Value: "Score"},
+		},
+	}
+	fmt.Println(t.init("db", testQuerier{}, testLogger))
+	t.Create("", []byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`))
+
+	ch := t.Watch(context.Background(), nil)
+	// the old row is removed, since its row in database is changed.
+	t.Update("",
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": 95}`),
+		[]byte(`{"StudentId": 1001, "Subject": "语文", "Score": "x"}`),
+	)
+	event := <-ch
+	fmt.Println(event.Type, event.Old, event.New, m)
+
+	// Output:
+	// <nil>
+	// delete {1001 语文 95} <nil> map[]
+}
@@ -1,14 +1,14 @@
 package pgcache
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/lovego/bsql"
-	"github.com/lovego/bsql/scan"
 	"github.com/lovego/pgcache/manage"
 )
 
@@ -21,20 +21,28 @@ type Table struct {
 
 	NoClear bool
 
-	// The struct to receive a table row.
+	// The struct to receive a table row. The column of a field can be set by a pgcache or db tag,
+	// and the pgcache tag can derive the config of the table, see "Columns" and "Datas", such as:
+	//   Id   int64  `pgcache:"pk"`
+	//   Name string `pgcache:"column=stuName,index"`
+	//   Bio  string `db:"bio" pgcache:"big"`
 	RowStruct interface{}
 
 	// The columns of the table to cache. It's got from the pg_notify payload, it must be less than
 	// 8000 bytes, use "BigColumns" if necessarry.
 	// If empty, the fields of "RowStruct" which is not "BigColumns" are used.
-	// The field name is converted to underscore style, and field with `json:"-"` tag is ignored.
+	// The column of a field is set by `pgcache:"column=name"` or `db:"name"` tag, or converted from
+	// the field name to underscore style. A field with a "-" pgcache or db tag is ignored, so is a
+	// field with `json:"-"` tag and neither of them. A column which doesn't map back to the field
+	// is aliased, such as `"stuName" AS name` of the "Name" field.
 	Columns string
 
-	// The big columns of the table to cache. It's got by a seperate query.
-	// Warning: when update, it will not be set on the old value.
+	// The big columns of the table to cache. It's got by a seperate query. If empty, the columns of
+	// the fields with `pgcache:"big"` tag are used.
+	// Warning: when update, it will not be set on the old value, unless "RowStore" is true.
 	BigColumns string
-	// The unique fields to load "BigColumns" from db. If empty, and "RowStruct" has a "Id" Field,
-	// it's used as "BigColumnsLoadKeys".
+	// The unique fields to load "BigColumns" from db. If empty, "PrimaryKey" is used, or if it's
+	// also empty, and "RowStruct" has a "Id" Field, it's used as "BigColumnsLoadKeys".
 	BigColumnsLoadKeys []string
 	// sql to load "BigColumns"
 	bigColumnsLoadSql string
@@ -42,9 +50,51 @@ type Table struct {
 	// The sql used to load initial data when a table is cached, or reload table data when the db
 	// connection lost. If empty, "Columns" and "BigColumns" is used to make a SELECT sql FROM "NAME".
 	LoadSql string
+	// CopyFormat is optional, it's "text" or "binary". If it's not empty, data is loaded by
+	// "COPY (LoadSql) TO STDOUT" in this format, and decoded directly into "RowStruct",
+	// so the db querier should implement "CopyQuerier".
+	// "LoadSql" should select "Columns" and "BigColumns" in this order. In "binary" format, they
+	// should be columns of the table, and their types are checked when the table is inited.
+	CopyFormat string
+	// sql to load data by COPY
+	copySql string
+	// the fields to store COPY columns
+	copyFields []copyField
 
-	// Datas is the maps to store table rows.
+	// SnapshotFile is optional. If it's not empty, rows are written to this file after every reload,
+	// and restored from it when the table is inited, so a restart needn't wait for the reload.
+	// After restored, the changes since the snapshot is made are caught up by "Journal". If
+	// "Journal" is nil, the rows are loaded, and only the rows differ from the snapshot are removed
+	// or saved, so the Datas are not cleared. If "Journal" fails, the table is reloaded.
+	SnapshotFile string
+	Journal      Journal
+
+	// Lazy is optional. If it's not nil, Datas are loaded key by key on demand by "Data.Get",
+	// instead of loading all rows when inited or reloaded.
+	Lazy *LazyOptions
+
+	// Verify is optional. If it's not nil, the cached rows are verified against database
+	// periodically, and the drifted rows are reloaded.
+	Verify *VerifyOptions
+
+	// RowStore is optional. If it's true, every row is kept by "PrimaryKey" in memory. Then the
+	// notifications of UPDATE and DELETE carry only the primary key and the changed columns, and
+	// the old value of "BigColumns" is taken from memory.
+	RowStore bool
+	// PrimaryKey is the fields of the primary key for "RowStore". If empty, the fields with
+	// `pgcache:"pk"` tag are used, or if there is no such field, it's got from pg_index.
+	PrimaryKey []string
+	rowStore   *rowStore
+
+	// Datas is the maps to store table rows. Use "AddData" and "RemoveData" to change it after
+	// the table is added to DB. If empty, it's derived from the pgcache tags of "RowStruct": a map
+	// of the rows by the fields of "pk", and a map of the sorted sets of the rows by each field of
+	// "index", in this order. They share a RWMutex, and can be read by "Data.Get".
 	Datas []*Data
+	// events hold the read lock, and "AddData", "RemoveData" hold the write lock.
+	datasMutex sync.RWMutex
+	// Datas grouped by RWMutex, each event is applied to a group in one critical section.
+	groups []*dataGroup
 
 	// db querier to load data from a table.
 	dbQuerier DBQuerier
@@ -53,25 +103,74 @@ type Table struct {
 	logger Logger
 
 	rowStruct reflect.Type
+	// the columns of the fields of rowStruct.
+	rowColumns []rowColumn
+	// the PostgreSQL types of the columns, only if any PG Decoder is registered.
+	pgTypes map[string]string
+	// to decode the content of notifications.
+	decodePlan *decodePlan
+	// RowStruct implements any of the row hooks.
+	hasHooks bool
+	// passed to "AfterLoad", canceled after the table is removed from DB.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// closed after data is loaded successfully for the first time.
+	ready     chan struct{}
+	readyOnce sync.Once
+	// closed after the table is removed from DB.
+	removed chan struct{}
+
+	subscriptionsMutex sync.Mutex
+	subscriptions      []*subscription
+}
+
+// Ready returns a channel which is closed after the table's data is loaded successfully for the
+// first time. If "Init" fails to load, the error is logged and the channel stays open, until a
+// later reload succeeds, such as after the db connection is lost and regained.
+func (t *Table) Ready() <-chan struct{} {
+	return t.ready
 }
 
 func (t *Table) Init(table string) {
+	if t.SnapshotFile != "" && t.restoreSnapshot() {
+		return
+	}
 	if err := t.Reload(t.NoClear); err != nil {
 		t.Error(err)
 	}
 }
 
 func (t *Table) Create(table string, content []byte) {
-	t.save(content)
+	var row reflect.Value
+	t.change(func() { row = t.save(content) })
+	t.notify(ChangeCreate, reflect.Value{}, row, nil)
 }
 
 func (t *Table) Update(table string, oldContent, newContent []byte) {
-	t.remove(oldContent)
-	t.save(newContent)
+	var oldRow, newRow reflect.Value
+	var changed []bool
+	t.change(func() { oldRow, newRow, changed = t.update(oldContent, newContent) })
+	if !newRow.IsValid() {
+		// the new row fails to decode or is rejected by the row hooks.
+		t.notify(ChangeDelete, oldRow, newRow, nil)
+		return
+	}
+	t.notify(ChangeUpdate, oldRow, newRow, changed)
 }
 
 func (t *Table) Delete(table string, content []byte) {
-	t.remove(content)
+	var row reflect.Value
+	t.change(func() { row = t.remove(content) })
+	t.notify(ChangeDelete, row, reflect.Value{}, nil)
+}
+
+// change calls fn to change the Datas with the read lock of Datas held, and publishes the changes.
+func (t *Table) change(fn func()) {
+	t.datasMutex.RLock()
+	defer t.datasMutex.RUnlock()
+	defer t.publish()
+	fn()
 }
 
 func (t *Table) ConnLoss(table string) {
@@ -83,50 +182,131 @@ func (t *Table) ConnLoss(table string) {
 }
 
 func (t *Table) Reload(noClear bool) error {
-	var rows = reflect.New(reflect.SliceOf(t.rowStruct)).Elem()
+	if t.Lazy != nil {
+		t.Clear()
+		t.readyOnce.Do(func() { close(t.ready) })
+		t.notify(ChangeReload, reflect.Value{}, reflect.Value{}, nil)
+		return nil
+	}
 	start := time.Now()
-	err := t.dbQuerier.Query(rows.Addr().Interface(), t.LoadSql)
+	var watermark string
+	if t.SnapshotFile != "" {
+		watermark = t.queryWatermark()
+	}
+	rows, err := t.loadRows()
 	msg := fmt.Sprintf("pgcache reload queryTime: %6v, ", time.Since(start).Round(time.Millisecond))
 	if err != nil {
 		log.Printf("%s \t%s.%s\n", msg, t.dbName, t.Name)
 		return fmt.Errorf("reload: %v", err)
 	}
+	t.datasMutex.RLock()
 	if !noClear {
-		t.Clear()
+		t.clear()
+	}
+	t.saveRows(rows)
+	t.publish()
+	t.datasMutex.RUnlock()
+	t.readyOnce.Do(func() { close(t.ready) })
+	if t.SnapshotFile != "" {
+		if err := t.writeSnapshot(rows, watermark); err != nil {
+			t.Error("write snapshot: " + err.Error())
+		}
 	}
-	t.Save(rows.Interface())
 	log.Printf("%s fullTime: %6v, \t%s.%s\n", msg, time.Since(start).Round(time.Millisecond),
 		t.dbName, t.Name)
+	t.notify(ChangeReload, reflect.Value{}, reflect.Value{}, nil)
 	return nil
 }
 
+// loadRows loads every row by "CopyFormat" or "LoadSql".
+func (t *Table) loadRows() (reflect.Value, error) {
+	var rows = reflect.New(reflect.SliceOf(t.rowStruct)).Elem()
+	var err error
+	if t.CopyFormat != "" {
+		err = t.copyLoad(rows)
+	} else {
+		err = t.dbQuerier.Query(rows.Addr().Interface(), t.LoadSql)
+	}
+	return rows, err
+}
+
 func (t *Table) Clear() {
-	for _, d := range t.Datas {
-		d.clear()
+	t.datasMutex.RLock()
+	defer t.datasMutex.RUnlock()
+	defer t.publish()
+	t.clear()
+}
+
+func (t *Table) clear() {
+	if t.rowStore != nil {
+		t.rowStore.clear()
+	}
+	for _, g := range t.groups {
+		g.clear()
 	}
 }
 
+// Save saves the rows to Datas, and notifies the subscribers of a "create" event for each row.
 func (t *Table) Save(rows interface{}) {
-	rowsV := reflect.ValueOf(rows)
+	var saved []reflect.Value
+	t.change(func() { saved = t.saveRows(reflect.ValueOf(rows)) })
+	for _, row := range saved {
+		t.notify(ChangeCreate, reflect.Value{}, row, nil)
+	}
+}
+
+// saveRows saves the rows, and returns the rows saved, which are accepted by the row hooks.
+func (t *Table) saveRows(rowsV reflect.Value) []reflect.Value {
+	var saved = make([]reflect.Value, 0, rowsV.Len())
 	for i := 0; i < rowsV.Len(); i++ {
 		row := rowsV.Index(i)
-		for _, d := range t.Datas {
-			d.save(row)
+		if !t.prepareRow(row, true) {
+			continue
 		}
+		t.saveRow(row)
+		saved = append(saved, row)
 	}
+	return saved
 }
 
+// saveRow saves a row which is prepared by the row hooks.
+func (t *Table) saveRow(row reflect.Value) {
+	if t.rowStore != nil {
+		t.rowStore.save(row)
+	}
+	for _, g := range t.groups {
+		g.save(row)
+	}
+}
+
+// removeRow removes a row which is prepared by the row hooks.
+func (t *Table) removeRow(row reflect.Value) {
+	if t.rowStore != nil {
+		t.rowStore.remove(row)
+	}
+	for _, g := range t.groups {
+		g.remove(row)
+	}
+}
+
+// Remove removes the rows from Datas, and notifies the subscribers of a "delete" event for each row.
 func (t *Table) Remove(rows interface{}) {
 	rowsV := reflect.ValueOf(rows)
-	for i := 0; i < rowsV.Len(); i++ {
-		row := rowsV.Index(i)
-		for _, d := range t.Datas {
-			d.remove(row)
+	t.change(func() {
+		for i := 0; i < rowsV.Len(); i++ {
+			row := rowsV.Index(i)
+			t.prepareRow(row, false)
+			t.removeRow(row)
 		}
+	})
+	for i := 0; i < rowsV.Len(); i++ {
+		t.notify(ChangeDelete, rowsV.Index(i), reflect.Value{}, nil)
 	}
 }
 
 func (t *Table) GetDatas() []manage.Data {
+	t.datasMutex.RLock()
+	defer t.datasMutex.RUnlock()
 	result := make([]manage.Data, len(t.Datas))
 	for i, data := range t.Datas {
 		result[i] = data
@@ -134,58 +314,123 @@ func (t *Table) GetDatas() []manage.Data {
 	return result
 }
 
-func (t *Table) save(content []byte) {
-	var row = reflect.New(t.rowStruct).Elem()
-	if err := jsonUnmarshal(content, row); err != nil {
+// publish publishes the changes of the Datas which has Snapshot.
+func (t *Table) publish() {
+	for _, g := range t.groups {
+		g.publish()
+	}
+}
+
+// save saves the row of the content, and returns the row. It returns an invalid value if the
+// content fails to decode, or the row is rejected by the row hooks.
+func (t *Table) save(content []byte) reflect.Value {
+	row, err := t.decodeRow(content, true)
+	if err != nil {
 		t.Error(err)
-		return
+		return reflect.Value{}
 	}
-	if t.BigColumns != "" {
-		var params = make([]interface{}, len(t.BigColumnsLoadKeys))
-		for i, key := range t.BigColumnsLoadKeys {
-			params[i] = bsql.V(row.FieldByName(key).Interface())
-		}
-		if err := t.dbQuerier.Query(row.Addr().Interface(), fmt.Sprintf(
-			t.bigColumnsLoadSql, params...,
-		)); err != nil {
-			t.Error(err)
-			return
+	if !t.prepareRow(row, true) {
+		return reflect.Value{}
+	}
+	t.saveRow(row)
+	return row
+}
+
+// update replaces the old row by the new row, and returns the rows and the changed fields.
+// If the new row fails to decode or is rejected by the row hooks, the old row is removed, and the
+// new row returned is invalid.
+func (t *Table) update(oldContent, newContent []byte) (reflect.Value, reflect.Value, []bool) {
+	oldRow, err := t.decodeRow(oldContent, false)
+	if err != nil {
+		t.Error(err)
+		return reflect.Value{}, t.save(newContent), nil
+	}
+	var newRow reflect.Value
+	if t.rowStore != nil {
+		stored, ok := t.rowStore.get(oldRow)
+		if !ok {
+			return reflect.Value{}, t.loadStoredRow(newContent), nil
 		}
+		// the content has only the primary key and the changed columns.
+		oldRow, newRow = stored, reflect.New(t.rowStruct).Elem()
+		newRow.Set(stored)
+		err = t.decodeInto(newRow, newContent, true)
+	} else {
+		t.prepareRow(oldRow, false)
+		newRow, err = t.decodeRow(newContent, true)
 	}
-	for _, d := range t.Datas {
-		d.save(row)
+	if err != nil {
+		t.Error(err)
+		// the row in database is changed, so the old row shouldn't be kept.
+		t.removeRow(oldRow)
+		return oldRow, reflect.Value{}, nil
+	}
+	if !t.prepareRow(newRow, true) {
+		t.removeRow(oldRow)
+		return oldRow, reflect.Value{}, nil
+	}
+	if t.rowStore != nil {
+		t.rowStore.remove(oldRow)
+		t.rowStore.save(newRow)
 	}
+	changed := changedFields(oldRow, newRow)
+	for _, g := range t.groups {
+		g.update(oldRow, newRow, changed)
+	}
+	return oldRow, newRow, changed
 }
 
-func (t *Table) remove(content []byte) {
-	var row = reflect.New(t.rowStruct).Elem()
-	if err := jsonUnmarshal(content, row); err != nil {
+// remove removes the row of the content, and returns the row.
+func (t *Table) remove(content []byte) reflect.Value {
+	row, err := t.decodeRow(content, false)
+	if err != nil {
 		t.Error(err)
-		return
+		return reflect.Value{}
+	}
+	if t.rowStore != nil {
+		stored, ok := t.rowStore.get(row)
+		if !ok {
+			// the content has only the primary key, and the row is not cached.
+			return reflect.Value{}
+		}
+		row = stored
+		t.rowStore.remove(row)
+	} else {
+		t.prepareRow(row, false)
 	}
-	for _, d := range t.Datas {
-		d.remove(row)
+	for _, g := range t.groups {
+		g.remove(row)
 	}
+	return row
 }
 
-func (t *Table) Error(err interface{}) {
-	t.logger.Errorf("pgcache (%s.%s) %v", t.dbName, t.Name, err)
+// decodeRow decodes a row from the notification content, and loads "BigColumns" if loadBig is true.
+func (t *Table) decodeRow(content []byte, loadBig bool) (reflect.Value, error) {
+	var row = reflect.New(t.rowStruct).Elem()
+	if err := t.decodeInto(row, content, loadBig); err != nil {
+		return reflect.Value{}, err
+	}
+	return row, nil
 }
 
-func jsonUnmarshal(content []byte, row reflect.Value) error {
-	var m = map[string]json.RawMessage{}
-
-	if err := json.Unmarshal(content, &m); err != nil {
+func (t *Table) decodeInto(row reflect.Value, content []byte, loadBig bool) error {
+	if err := t.decodePlan.decode(content, row); err != nil {
 		return err
 	}
-
-	for k, v := range m {
-		if field := row.FieldByName(scan.Column2Field(k)); field.IsValid() {
-			if err := json.Unmarshal(v, field.Addr().Interface()); err != nil {
-				return err
-			}
+	if loadBig && t.BigColumns != "" {
+		var params = make([]interface{}, len(t.BigColumnsLoadKeys))
+		for i, key := range t.BigColumnsLoadKeys {
+			params[i] = bsql.V(row.FieldByName(key).Interface())
+		}
+		if err := t.dbQuerier.Query(row.Addr().Interface(), fmt.Sprintf(
+			t.bigColumnsLoadSql, params...,
+		)); err != nil {
+			return err
 		}
 	}
-
 	return nil
 }
+
+func (t *Table) Error(err interface{}) {
+	t.logger.Errorf("pgcache (%s.%s) %v", t.dbName, t.Name, err)
+}
@@ -15,9 +15,15 @@ var testLogger = logger.New(os.Stdout)
 type testQuerier struct{}
 
 func (q testQuerier) Query(data interface{}, sql string, args ...interface{}) error {
-	rows := data.(*[]Score)
-	*rows = []Score{
-		{StudentId: 1000, Subject: "语文", Score: 90},
+	switch v := data.(type) {
+	case *string:
+		*v = "0/16B3748"
+	case *[]string:
+		*v = []string{"student_id", "subject"}
+	case *[]Score:
+		*v = []Score{
+			{StudentId: 1000, Subject: "语文", Score: 90},
+		}
 	}
 	return nil
 }
@@ -73,6 +79,67 @@ func ExampleTable() {
 	// map[1001:map[语文:95]] map[语文:map[1001:95]]
 }
 
+func ExampleTable_Ready() {
+	var m map[int]map[string]int
+	var mutex sync.RWMutex
+	t := &Table{
+		Name:      "scores",
+		RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	t.init("db", testQuerier{}, testLogger)
+
+	select {
+	case <-t.Ready():
+		fmt.Println("ready")
+	default:
+		fmt.Println("not ready")
+	}
+	t.Init("")
+	<-t.Ready()
+	fmt.Println("ready")
+	t.Init("") // ready only once
+	fmt.Println(m)
+
+	// Output:
+	// not ready
+	// ready
+	// map[1000:map[语文:90]]
+}
+
+func ExampleTable_Ready_loadFailed() {
+	var m map[int]map[string]int
+	var mutex sync.RWMutex
+	var fails = 1
+	t := &Table{
+		Name:      "scores",
+		RowStruct: Score{},
+		Datas: []*Data{
+			{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId", "Subject"}, Value: "Score"},
+		},
+	}
+	t.init("db", testReconcileQuerier{fails: &fails}, testLogger)
+
+	// the error is logged, and the table is not ready.
+	t.Init("")
+	select {
+	case <-t.Ready():
+		fmt.Println("ready")
+	default:
+		fmt.Println("not ready")
+	}
+	// until it's reloaded successfully.
+	t.ConnLoss("")
+	<-t.Ready()
+	fmt.Println("ready", m)
+
+	// Output:
+	// not ready
+	// ready map[1000:map[数学:80] 1001:map[语文:96]]
+}
+
 func ExamplePointerValue_1() {
 	var m map[string]int
 	v := reflect.ValueOf(&m).Elem()
@@ -5,9 +5,6 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
-
-	"github.com/lovego/struct_tag"
-	"github.com/lovego/structs"
 )
 
 func (t *Table) init(dbName string, dbQuerier DBQuerier, logger Logger) error {
@@ -20,9 +17,13 @@ func (t *Table) init(dbName string, dbQuerier DBQuerier, logger Logger) error {
 	if t.rowStruct.Kind() != reflect.Struct {
 		return errors.New("RowStruct is not a struct")
 	}
+	t.initHooks()
+	if err := t.initColumns(); err != nil {
+		return err
+	}
 
 	if t.Columns == "" {
-		t.Columns = columnsFromRowStruct(t.rowStruct, t.BigColumns)
+		t.Columns = columnsFromRowStruct(t.rowColumns, t.BigColumns)
 	}
 
 	if t.BigColumns != "" {
@@ -39,22 +40,68 @@ func (t *Table) init(dbName string, dbQuerier DBQuerier, logger Logger) error {
 		t.LoadSql = fmt.Sprintf("SELECT %s %s FROM %s", t.Columns, bigColumns, t.Name)
 	}
 
+	if t.CopyFormat != "" {
+		if err := t.initCopy(dbQuerier); err != nil {
+			return err
+		}
+	}
+
 	if len(t.Datas) == 0 {
 		return errors.New("Datas should not be empty")
 	}
 	for i := range t.Datas {
-		if err := t.Datas[i].init(t.rowStruct); err != nil {
+		if err := t.initData(t.Datas[i]); err != nil {
+			return err
+		}
+	}
+	t.groups = groupDatas(t.Datas)
+	if t.RowStore {
+		if err := t.initRowStore(dbQuerier); err != nil {
+			return err
+		}
+	}
+	if err := t.initPGTypes(dbQuerier); err != nil {
+		return err
+	}
+	t.decodePlan = newDecodePlan(t.rowStruct, t.rowColumns, t.pgTypes)
+	if t.Verify != nil {
+		if t.Lazy != nil {
+			return errors.New("Verify is not supported for a lazy table.")
+		}
+		if err := t.initVerify(); err != nil {
 			return err
 		}
 	}
 	t.dbQuerier, t.logger = dbQuerier, logger
+	t.ready, t.removed = make(chan struct{}), make(chan struct{})
 
 	return nil
 }
 
+func (t *Table) initData(d *Data) error {
+	if err := d.init(t.rowStruct); err != nil {
+		return err
+	}
+	d.table = t
+	if t.Lazy != nil {
+		if err := d.initLazy(t); err != nil {
+			return err
+		}
+	}
+	if err := d.initSnapshot(t.Lazy != nil); err != nil {
+		return err
+	}
+	if err := d.initLimit(t); err != nil {
+		return err
+	}
+	return d.initChangeFields(t.rowStruct)
+}
+
 func (t *Table) initBigColumns() error {
 	if len(t.BigColumnsLoadKeys) == 0 {
-		if _, ok := t.rowStruct.FieldByName("Id"); ok {
+		if len(t.PrimaryKey) > 0 {
+			t.BigColumnsLoadKeys = t.PrimaryKey
+		} else if _, ok := t.rowStruct.FieldByName("Id"); ok {
 			t.BigColumnsLoadKeys = []string{"Id"}
 		} else {
 			return errors.New("BigColumnsLoadKeys is required.")
@@ -68,7 +115,7 @@ func (t *Table) initBigColumns() error {
 	}
 	var columns []string
 	for _, field := range t.BigColumnsLoadKeys {
-		columns = append(columns, Field2Column(field)+" = %s")
+		columns = append(columns, quoteColumn(t.column(field).column)+" = %s")
 	}
 	t.bigColumnsLoadSql = fmt.Sprintf(`SELECT %s FROM %s WHERE `, t.BigColumns, t.Name) +
 		strings.Join(columns, " AND ")
@@ -76,25 +123,58 @@ func (t *Table) initBigColumns() error {
 	return nil
 }
 
-func columnsFromRowStruct(rowStruct reflect.Type, exclude string) string {
-	var excluding []string
-	if exclude != "" {
-		excluding = strings.Split(exclude, ",")
-		for i := range excluding {
-			excluding[i] = strings.TrimSpace(excluding[i])
-		}
+func (t *Table) initCopy(dbQuerier DBQuerier) error {
+	if _, ok := dbQuerier.(CopyQuerier); !ok {
+		return errors.New("CopyFormat: the db querier is not a CopyQuerier.")
+	}
+	switch t.CopyFormat {
+	case "text":
+		t.copySql = fmt.Sprintf("COPY (%s) TO STDOUT", t.LoadSql)
+	case "binary":
+		t.copySql = fmt.Sprintf("COPY (%s) TO STDOUT WITH (FORMAT binary)", t.LoadSql)
+	default:
+		return fmt.Errorf(`CopyFormat: %s, should be "text" or "binary".`, t.CopyFormat)
 	}
 
-	var result []string
-	structs.TraverseType(rowStruct, func(field reflect.StructField) {
-		if value, ok := struct_tag.Lookup(string(field.Tag), `json`); !ok || value != "-" {
-			column := Field2Column(field.Name)
-			if len(excluding) == 0 || notIn(column, excluding) {
-				result = append(result, column)
-			}
+	columns := strings.Split(t.Columns, ",")
+	if t.BigColumns != "" {
+		columns = append(columns, strings.Split(t.BigColumns, ",")...)
+	}
+	var pgTypes map[string]string
+	if t.CopyFormat == "binary" {
+		var err error
+		if pgTypes, err = t.queryPGTypes(dbQuerier); err != nil {
+			return err
+		}
+	}
+	fields := t.fieldsByColumn()
+	t.copyFields = make([]copyField, len(columns))
+	for i := range columns {
+		column := copyColumnName(columns[i])
+		field, ok := fields[column]
+		if !ok {
+			return fmt.Errorf(`CopyFormat: column "%s" has no matching field in RowStruct.`, column)
+		}
+		t.copyFields[i] = copyField{column: column, index: field.Index}
+		if t.CopyFormat == "text" {
+			t.copyFields[i].text = copyTextDecoder(field.Type)
+			continue
 		}
-	})
-	return strings.Join(result, ",")
+		pgType, ok := pgTypes[t.column(field.Name).column]
+		if !ok {
+			return fmt.Errorf(
+				`CopyFormat: column "%s" is not a column of %s, its binary format is unknown.`,
+				column, t.Name,
+			)
+		}
+		if t.copyFields[i].binary = copyBinaryDecoder(pgType, field.Type); t.copyFields[i].binary == nil {
+			return fmt.Errorf(
+				`CopyFormat: column "%s", binary format of type "%s" is not supported for %v.`,
+				column, pgType, field.Type,
+			)
+		}
+	}
+	return nil
 }
 
 /* 单词边界有两种
@@ -0,0 +1,370 @@
+package pgcache
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VerifyOptions makes a table verify periodically that the cached rows are the same as the rows in
+// database. Rows are grouped into buckets by "Keys", and the count and checksum of each bucket is
+// computed both by SQL and over the cached rows. The mismatching buckets are reloaded.
+// Only columns of integer, float, string, bool and time.Time type(or pointer to them) are checked.
+// The cached rows are got from the first Data whose value is the whole row and has no Precond,
+// so it should contain every row.
+type VerifyOptions struct {
+	// Interval between verifications, required.
+	Interval time.Duration
+	// Buckets is the number of buckets, default is 1024.
+	Buckets int
+	// Keys is the unique fields to get bucket of a row. If empty, and "RowStruct" has a "Id" Field,
+	// it's used as "Keys".
+	Keys []string
+
+	// the Data to get cached rows, its value is the whole row and has no Precond.
+	data    *Data
+	keys    []verifyColumn
+	columns []verifyColumn
+	sql     string
+
+	mutex sync.Mutex
+	stats VerifyStats
+}
+
+// VerifyStats is the statistics of verifications.
+type VerifyStats struct {
+	Runs int
+	// Drifts is the total number of mismatching buckets found.
+	Drifts     int
+	LastRunAt  time.Time
+	LastDrifts int
+	LastError  string
+}
+
+type verifyColumn struct {
+	index []int
+	// sql expression to convert the column to text, NULL is converted to the same text of Go.
+	sql  string
+	text func(reflect.Value) string
+}
+
+type verifyBucket struct {
+	Bucket   int
+	Count    int64
+	Checksum int64
+}
+
+const verifyNull = `\N`
+
+// checksum is a 60 bits unsigned integer, so sum of checksums is computed modulo 2^60.
+const verifyChecksumMask = 1<<60 - 1
+
+func (t *Table) initVerify() error {
+	v := t.Verify
+	if v.Interval <= 0 {
+		return errors.New("Verify.Interval should be positive.")
+	}
+	if v.Buckets <= 0 {
+		v.Buckets = 1024
+	}
+	if v.data = t.rowsData(); v.data == nil {
+		return errors.New("Verify: no Data whose value is the whole row and has no Precond.")
+	}
+	if len(v.Keys) == 0 {
+		if _, ok := t.rowStruct.FieldByName("Id"); ok {
+			v.Keys = []string{"Id"}
+		} else {
+			return errors.New("Verify.Keys is required.")
+		}
+	}
+	for _, name := range v.Keys {
+		field, ok := t.rowStruct.FieldByName(name)
+		if !ok {
+			return fmt.Errorf(`Verify.Keys: illegal field "%s".`, name)
+		}
+		column, ok := newVerifyColumn(quoteColumn(t.column(name).name), field)
+		if !ok {
+			return fmt.Errorf(`Verify.Keys: field "%s" is of unsupported type.`, name)
+		}
+		v.keys = append(v.keys, column)
+	}
+
+	fields := t.fieldsByColumn()
+	columns := strings.Split(t.Columns, ",")
+	if t.BigColumns != "" {
+		columns = append(columns, strings.Split(t.BigColumns, ",")...)
+	}
+	for _, item := range columns {
+		column := copyColumnName(item)
+		if field, ok := fields[column]; ok {
+			// a quoted name keeps its case.
+			sqlName := column
+			if strings.HasSuffix(strings.TrimSpace(item), `"`) {
+				sqlName = quoteColumn(column)
+			}
+			if c, ok := newVerifyColumn(sqlName, field); ok {
+				v.columns = append(v.columns, c)
+			}
+		}
+	}
+
+	v.sql = fmt.Sprintf(`SELECT bucket, count(*) AS count,
+  (sum(checksum) %% %d)::bigint AS checksum
+FROM (
+  SELECT %s AS bucket, %s AS checksum
+  FROM (%s) AS t
+) AS t
+GROUP BY bucket`,
+		uint64(verifyChecksumMask)+1,
+		verifySqlHash(v.keys, 7, 28)+fmt.Sprintf(" %% %d", v.Buckets),
+		verifySqlHash(v.columns, 15, 60), t.LoadSql,
+	)
+	return nil
+}
+
+func verifySqlHash(columns []verifyColumn, hexDigits, bits int) string {
+	var exprs []string
+	for _, c := range columns {
+		exprs = append(exprs, c.sql)
+	}
+	return fmt.Sprintf("('x' || substr(md5(%s), 1, %d))::bit(%d)::bigint",
+		strings.Join(exprs, " || chr(31) || "), hexDigits, bits,
+	)
+}
+
+func verifyGoHash(row reflect.Value, columns []verifyColumn, hexDigits int) uint64 {
+	var texts = make([]string, len(columns))
+	for i, c := range columns {
+		texts[i] = c.text(row.FieldByIndex(c.index))
+	}
+	sum := md5.Sum([]byte(strings.Join(texts, "\x1f")))
+	n, _ := strconv.ParseUint(hex.EncodeToString(sum[:])[:hexDigits], 16, 64)
+	return n
+}
+
+func newVerifyColumn(column string, field reflect.StructField) (verifyColumn, bool) {
+	typ := field.Type
+	isPtr := typ.Kind() == reflect.Ptr
+	if isPtr {
+		typ = typ.Elem()
+	}
+	var sql string
+	var text func(reflect.Value) string
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		sql = column + "::text"
+		text = func(v reflect.Value) string { return strconv.FormatInt(v.Int(), 10) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		sql = column + "::text"
+		text = func(v reflect.Value) string { return strconv.FormatUint(v.Uint(), 10) }
+	case reflect.Float32, reflect.Float64:
+		sql = column + "::float8::text"
+		text = func(v reflect.Value) string { return pgFloatText(v.Float()) }
+	case reflect.String:
+		sql = column + "::text"
+		text = func(v reflect.Value) string { return v.String() }
+	case reflect.Bool:
+		sql = column + "::text"
+		text = func(v reflect.Value) string { return strconv.FormatBool(v.Bool()) }
+	default:
+		if typ != timeType {
+			return verifyColumn{}, false
+		}
+		sql = "round(extract(epoch from " + column + ") * 1000000)::bigint::text"
+		text = func(v reflect.Value) string {
+			t := v.Interface().(time.Time)
+			return strconv.FormatInt(t.Unix()*1000000+int64(t.Nanosecond()/1000), 10)
+		}
+	}
+
+	if isPtr {
+		elemText := text
+		text = func(v reflect.Value) string {
+			if v.IsNil() {
+				return verifyNull
+			}
+			return elemText(v.Elem())
+		}
+		sql = fmt.Sprintf("coalesce(%s, %s)", sql, quote(verifyNull))
+	} else {
+		// NULL is scanned as zero value.
+		sql = fmt.Sprintf("coalesce(%s, %s)", sql, quote(text(reflect.Zero(typ))))
+	}
+	return verifyColumn{index: field.Index, sql: sql, text: text}, true
+}
+
+// pgFloatText formats a float the same as PostgreSQL's float8 output.
+func pgFloatText(f float64) string {
+	if f == 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		switch {
+		case math.IsInf(f, 1):
+			return "Infinity"
+		case math.IsInf(f, -1):
+			return "-Infinity"
+		case math.IsNaN(f):
+			return "NaN"
+		}
+		return "0"
+	}
+	str := strconv.FormatFloat(f, 'e', -1, 64)
+	if exp, _ := strconv.Atoi(str[strings.IndexByte(str, 'e')+1:]); exp < -4 || exp >= 15 {
+		return str
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func (t *Table) startVerify() {
+	go func() {
+		ticker := time.NewTicker(t.Verify.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := t.VerifyOnce(); err != nil {
+					t.Error("verify: " + err.Error())
+				}
+			case <-t.removed:
+				return
+			}
+		}
+	}()
+}
+
+// VerifyOnce verifies the cached rows against database, reloads the mismatching buckets,
+// and returns the number of mismatching buckets.
+func (t *Table) VerifyOnce() (int, error) {
+	if t.Verify == nil {
+		return 0, errors.New("Verify is not configured.")
+	}
+	v := t.Verify
+	var dbBuckets []verifyBucket
+	err := t.dbQuerier.Query(&dbBuckets, v.sql)
+	var drifts []int
+	if err == nil {
+		cached := t.verifyCachedBuckets()
+		for _, b := range dbBuckets {
+			if c := cached[b.Bucket]; c.Count != b.Count || c.Checksum != b.Checksum {
+				drifts = append(drifts, b.Bucket)
+			}
+			delete(cached, b.Bucket)
+		}
+		for bucket := range cached {
+			drifts = append(drifts, bucket)
+		}
+		if len(drifts) > 0 {
+			sort.Ints(drifts)
+			t.Error(fmt.Sprintf("verify: %d buckets drifted.", len(drifts)))
+			err = t.reloadBuckets(drifts)
+		}
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.stats.Runs++
+	v.stats.Drifts += len(drifts)
+	v.stats.LastRunAt = time.Now()
+	v.stats.LastDrifts = len(drifts)
+	if err != nil {
+		v.stats.LastError = err.Error()
+	} else {
+		v.stats.LastError = ""
+	}
+	return len(drifts), err
+}
+
+// VerifyStats returns the statistics of verifications.
+func (t *Table) VerifyStats() VerifyStats {
+	if t.Verify == nil {
+		return VerifyStats{}
+	}
+	t.Verify.mutex.Lock()
+	defer t.Verify.mutex.Unlock()
+	return t.Verify.stats
+}
+
+func (t *Table) verifyCachedBuckets() map[int]verifyBucket {
+	v := t.Verify
+	var result = make(map[int]verifyBucket)
+	v.data.eachRow(func(row reflect.Value) {
+		bucket := int(verifyGoHash(row, v.keys, 7) % uint64(v.Buckets))
+		b := result[bucket]
+		b.Bucket = bucket
+		b.Count++
+		b.Checksum = int64((uint64(b.Checksum) + verifyGoHash(row, v.columns, 15)) & verifyChecksumMask)
+		result[bucket] = b
+	})
+	return result
+}
+
+// reloadBuckets removes the cached rows of the buckets, and saves the rows loaded from database.
+// The subscribers are notified of the rows which are different.
+func (t *Table) reloadBuckets(buckets []int) error {
+	v := t.Verify
+	var inBuckets = make(map[int]bool, len(buckets))
+	var list = make([]string, len(buckets))
+	for i, bucket := range buckets {
+		inBuckets[bucket] = true
+		list[i] = strconv.Itoa(bucket)
+	}
+	var rows = reflect.New(reflect.SliceOf(t.rowStruct)).Elem()
+	if err := t.dbQuerier.Query(rows.Addr().Interface(), fmt.Sprintf(
+		"SELECT * FROM (%s) AS t WHERE %s %% %d IN (%s)",
+		t.LoadSql, verifySqlHash(v.keys, 7, 28), v.Buckets, strings.Join(list, ","),
+	)); err != nil {
+		return err
+	}
+
+	var stale []reflect.Value
+	var staleByKey = make(map[string]reflect.Value)
+	v.data.eachRow(func(row reflect.Value) {
+		if inBuckets[int(verifyGoHash(row, v.keys, 7)%uint64(v.Buckets))] {
+			stale = append(stale, row)
+			staleByKey[v.key(row)] = row
+		}
+	})
+	var saved []reflect.Value
+	t.change(func() {
+		for _, row := range stale {
+			t.removeRow(row)
+		}
+		saved = t.saveRows(rows)
+	})
+
+	for _, row := range saved {
+		key := v.key(row)
+		old, ok := staleByKey[key]
+		delete(staleByKey, key)
+		if !ok {
+			t.notify(ChangeCreate, reflect.Value{}, row, nil)
+		} else if changed := changedFields(old, row); len(changedNames(t.rowStruct, changed)) > 0 {
+			t.notify(ChangeUpdate, old, row, changed)
+		}
+	}
+	for _, row := range stale {
+		if _, ok := staleByKey[v.key(row)]; ok {
+			t.notify(ChangeDelete, row, reflect.Value{}, nil)
+		}
+	}
+	return nil
+}
+
+// key returns the text of the "Keys" of a row.
+func (v *VerifyOptions) key(row reflect.Value) string {
+	var texts = make([]string, len(v.keys))
+	for i, c := range v.keys {
+		texts[i] = c.text(row.FieldByIndex(c.index))
+	}
+	return strings.Join(texts, "\x1f")
+}
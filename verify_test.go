@@ -0,0 +1,127 @@
+package pgcache
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// verifyQuerier simulates a database which has "scores".
+type verifyQuerier struct {
+	t      *Table
+	scores []Score
+}
+
+var bucketsRegexp = regexp.MustCompile(`IN \(([\d,]+)\)`)
+
+func (q verifyQuerier) Query(data interface{}, sql string, args ...interface{}) error {
+	v := q.t.Verify
+	if strings.HasPrefix(sql, "SELECT bucket") {
+		var buckets = make(map[int]verifyBucket)
+		for _, score := range q.scores {
+			row := reflect.ValueOf(score)
+			bucket := int(verifyGoHash(row, v.keys, 7) % uint64(v.Buckets))
+			b := buckets[bucket]
+			b.Bucket = bucket
+			b.Count++
+			b.Checksum = int64((uint64(b.Checksum) + verifyGoHash(row, v.columns, 15)) &
+				verifyChecksumMask)
+			buckets[bucket] = b
+		}
+		for _, b := range buckets {
+			*data.(*[]verifyBucket) = append(*data.(*[]verifyBucket), b)
+		}
+		return nil
+	}
+	inBuckets := "," + bucketsRegexp.FindStringSubmatch(sql)[1] + ","
+	fmt.Println("reload buckets:", strings.Trim(inBuckets, ","))
+	for _, score := range q.scores {
+		bucket := verifyGoHash(reflect.ValueOf(score), v.keys, 7) % uint64(v.Buckets)
+		if strings.Contains(inBuckets, fmt.Sprintf(",%d,", bucket)) {
+			*data.(*[]Score) = append(*data.(*[]Score), score)
+		}
+	}
+	return nil
+}
+
+func (q verifyQuerier) GetDB() *sql.DB {
+	return nil
+}
+
+func ExampleTable_VerifyOnce() {
+	var m map[int]Score
+	var mutex sync.RWMutex
+	t := &Table{
+		Name: "scores", RowStruct: Score{},
+		Verify: &VerifyOptions{Interval: time.Minute, Buckets: 4, Keys: []string{"StudentId"}},
+		Datas:  []*Data{{RWMutex: &mutex, DataPtr: &m, MapKeys: []string{"StudentId"}}},
+	}
+	q := &verifyQuerier{t: t, scores: []Score{
+		{StudentId: 1001, Subject: "语文", Score: 90},
+		{StudentId: 1002, Subject: "数学", Score: 80},
+		{StudentId: 1003, Subject: "英语", Score: 70},
+	}}
+	fmt.Println(t.init("db", q, testLogger))
+	fmt.Println(t.Verify.sql)
+	events := make(chan ChangeEvent, 10)
+	t.Subscribe(func(event ChangeEvent) { events <- event }, &SubscribeOptions{Overflow: OverflowBlock})
+
+	t.Save([]Score{
+		{StudentId: 1001, Subject: "语文", Score: 90},
+		{StudentId: 1002, Subject: "数学", Score: 85},
+		{StudentId: 1004, Subject: "英语", Score: 60},
+	})
+	for i := 0; i < 3; i++ {
+		event := <-events
+		fmt.Println(event.Type, event.New)
+	}
+	fmt.Println(t.VerifyOnce())
+	fmt.Println(m)
+	for i := 0; i < 3; i++ {
+		event := <-events
+		fmt.Println(event.Type, event.Old, event.New, event.Changed)
+	}
+	fmt.Println(t.VerifyOnce())
+	stats := t.VerifyStats()
+	fmt.Println(stats.Runs, stats.Drifts, stats.LastDrifts, stats.LastError)
+
+	// Output:
+	// <nil>
+	// SELECT bucket, count(*) AS count,
+	//   (sum(checksum) % 1152921504606846976)::bigint AS checksum
+	// FROM (
+	//   SELECT ('x' || substr(md5(coalesce(student_id::text, '0')), 1, 7))::bit(28)::bigint % 4 AS bucket, ('x' || substr(md5(coalesce(student_id::text, '0') || chr(31) || coalesce(subject::text, '') || chr(31) || coalesce(score::text, '0')), 1, 15))::bit(60)::bigint AS checksum
+	//   FROM (SELECT student_id,subject,score  FROM scores) AS t
+	// ) AS t
+	// GROUP BY bucket
+	// create {1001 语文 90}
+	// create {1002 数学 85}
+	// create {1004 英语 60}
+	// reload buckets: 0,1
+	// 2 <nil>
+	// map[1001:{1001 语文 90} 1002:{1002 数学 80} 1003:{1003 英语 70}]
+	// update {1002 数学 85} {1002 数学 80} [Score]
+	// create <nil> {1003 英语 70} []
+	// delete {1004 英语 60} <nil> []
+	// 0 <nil>
+	// 2 2 0
+}
+
+func Example_pgFloatText() {
+	for _, f := range []float64{0, 1.5, -0.0001, 0.00001, 123456789012345, 1e15, 1e20, 1.0 / 3} {
+		fmt.Println(pgFloatText(f))
+	}
+	// Output:
+	// 0
+	// 1.5
+	// -0.0001
+	// 1e-05
+	// 123456789012345
+	// 1e+15
+	// 1e+20
+	// 0.3333333333333333
+}